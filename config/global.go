@@ -5,7 +5,10 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/3scale-ops/basereconciler/util"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
@@ -18,11 +21,19 @@ var config = struct {
 	annotationsDomain              string
 	resourcePruner                 bool
 	dynamicWatches                 bool
+	referenceTracking              bool
+	generatedReferenceCheck        bool
+	hashAlgorithm                  util.HashAlgorithm
+	imageOverrides                 map[string]string
+	propagation                    PropagationConfig
 	defaultResourceReconcileConfig map[string]ReconcileConfigForGVK
 }{
 	annotationsDomain: "basereconciler.3cale.net",
 	resourcePruner:    true,
 	dynamicWatches:    true,
+	referenceTracking: false,
+	hashAlgorithm:     util.HashAlgorithmSHA256,
+	imageOverrides:    map[string]string{},
 	defaultResourceReconcileConfig: map[string]ReconcileConfigForGVK{
 		"*": {
 			EnsureProperties: []string{
@@ -69,6 +80,163 @@ func DisableDynamicWatches() { config.dynamicWatches = false }
 // AreDynamicWatchesEnabled returs a boolean indicating wheter the dynamic watches are enabled or not.
 func AreDynamicWatchesEnabled() bool { return config.dynamicWatches }
 
+// EnableReferenceTracking enables reference tracking. When enabled, the reconciler records the objects
+// (Secrets, ConfigMaps, ...) read through the client by the templates while building the resources and
+// watches them, so changes in those objects trigger a reconcile of the custom resources that use them.
+func EnableReferenceTracking() { config.referenceTracking = true }
+
+// DisableReferenceTracking disables reference tracking. When enabled, the reconciler records the objects
+// (Secrets, ConfigMaps, ...) read through the client by the templates while building the resources and
+// watches them, so changes in those objects trigger a reconcile of the custom resources that use them.
+func DisableReferenceTracking() { config.referenceTracking = false }
+
+// IsReferenceTrackingEnabled returs a boolean indicating wheter reference tracking is enabled or not.
+func IsReferenceTrackingEnabled() bool { return config.referenceTracking }
+
+// EnableGeneratedReferenceCheck enables the reference check of the resource pruner for the ConfigMaps and
+// Secrets generated by resource.GeneratedTemplate. When enabled, the old generations of the generated objects
+// are kept while they are referenced by any Pod, ReplicaSet, Deployment, StatefulSet, DaemonSet, Job or
+// CronJob in their namespace, so pods that have not been rolled out yet don't lose their configuration. The
+// workloads are listed directly from the API server, namespace by namespace, and only when there are generated
+// objects to prune, so the controller requires RBAC permissions to list pods, replicasets, deployments,
+// statefulsets, daemonsets, jobs and cronjobs. The old generations referenced by the pod templates of the
+// workloads managed by the same owner are always kept, even if the reference check is disabled.
+func EnableGeneratedReferenceCheck() { config.generatedReferenceCheck = true }
+
+// DisableGeneratedReferenceCheck disables the reference check of the resource pruner for the ConfigMaps
+// and Secrets generated by resource.GeneratedTemplate (see EnableGeneratedReferenceCheck). When disabled,
+// the old generations are pruned once the workloads managed by the same owner no longer reference them.
+func DisableGeneratedReferenceCheck() { config.generatedReferenceCheck = false }
+
+// IsGeneratedReferenceCheckEnabled returns a boolean indicating whether the reference check of
+// generated objects is enabled or not.
+func IsGeneratedReferenceCheckEnabled() bool { return config.generatedReferenceCheck }
+
+// GetHashAlgorithm returns the globally configured hash algorithm. The hash algorithm
+// is used to compute the hashes of the rollout trigger annotations (see the mutators package).
+func GetHashAlgorithm() util.HashAlgorithm { return config.hashAlgorithm }
+
+// SetHashAlgorithm globally configures the hash algorithm. The hash algorithm is used to
+// compute the hashes of the rollout trigger annotations (see the mutators package). Defaults
+// to util.HashAlgorithmSHA256.
+func SetHashAlgorithm(algorithm util.HashAlgorithm) { config.hashAlgorithm = algorithm }
+
+// RelatedImageEnvPrefix is the prefix of the environment variables that hold
+// the images related to the operator (see LoadImageOverridesFromEnv)
+const RelatedImageEnvPrefix = "RELATED_IMAGE_"
+
+// SetImageOverrides globally configures the container image overrides used by the
+// mutators.OverrideImages mutator. The keys of the map are the images to override, either
+// full image references ("quay.io/3scale/apicast:v1") or image repositories ("quay.io/3scale/apicast"),
+// which match any tag or digest of the repository. The values are the images to use instead.
+func SetImageOverrides(overrides map[string]string) {
+	config.imageOverrides = make(map[string]string, len(overrides))
+	for k, v := range overrides {
+		config.imageOverrides[k] = v
+	}
+}
+
+// GetImageOverrides returns a copy of the globally configured container image overrides
+func GetImageOverrides() map[string]string {
+	overrides := make(map[string]string, len(config.imageOverrides))
+	for k, v := range config.imageOverrides {
+		overrides[k] = v
+	}
+	return overrides
+}
+
+// GetImageOverride returns the image that overrides the given image, if any. An override
+// for the full image reference takes precedence over an override for its repository.
+func GetImageOverride(image string) (string, bool) {
+	if override, ok := config.imageOverrides[image]; ok {
+		return override, true
+	}
+	override, ok := config.imageOverrides[util.ImageRepository(image)]
+	return override, ok
+}
+
+// RelatedImage maps one of the "RELATED_IMAGE_*" environment variables to the image
+// that it overrides (see LoadImageOverridesFromEnv)
+type RelatedImage struct {
+	// Name is the name of the environment variable, without the RELATED_IMAGE_ prefix
+	Name string
+	// Image is the image used in the templates that is overridden by the value of
+	// the environment variable, either a full image reference or an image repository
+	Image string
+}
+
+// LoadImageOverridesFromEnv adds an image override for each one of the "RELATED_IMAGE_*" environment
+// variables, which is how OLM passes the images related to an operator, pinned by digest for disconnected
+// installs. By default each image overrides any other image of the same repository, so for example with
+// "RELATED_IMAGE_APICAST=quay.io/3scale/apicast@sha256:abcd" any "quay.io/3scale/apicast" image used in
+// the templates is replaced by the pinned one. When the images are mirrored to a different registry the
+// repositories don't match, so the image that each variable overrides has to be passed explicitly:
+//
+//	config.LoadImageOverridesFromEnv(config.RelatedImage{Name: "APICAST", Image: "quay.io/3scale/apicast"})
+//
+// It is typically called once in the main function of the operator.
+func LoadImageOverridesFromEnv(images ...RelatedImage) {
+	for _, env := range os.Environ() {
+		name, value, ok := strings.Cut(env, "=")
+		if !ok || !strings.HasPrefix(name, RelatedImageEnvPrefix) || value == "" {
+			continue
+		}
+		key := util.ImageRepository(value)
+		for _, image := range images {
+			if RelatedImageEnvPrefix+image.Name == name {
+				key = image.Image
+				break
+			}
+		}
+		config.imageOverrides[key] = value
+	}
+}
+
+// PropagationConfig configures the labels and annotations of the custom resources that are
+// propagated to all the resources they own (see mutators.PropagateOwnerMetadata). Propagation
+// is disabled unless some key or prefix is configured.
+type PropagationConfig struct {
+	// Labels is the list of label keys that are propagated
+	Labels []string
+	// LabelPrefixes is the list of prefixes of the label keys that are propagated
+	LabelPrefixes []string
+	// Annotations is the list of annotation keys that are propagated
+	Annotations []string
+	// AnnotationPrefixes is the list of prefixes of the annotation keys that are propagated
+	AnnotationPrefixes []string
+	// PodTemplates enables the propagation to the pod templates of the owned
+	// workloads. Note that changes in the propagated keys will trigger rollouts.
+	PodTemplates bool
+}
+
+// IsEnabled returns true if any label or annotation is propagated
+func (pc PropagationConfig) IsEnabled() bool {
+	return len(pc.Labels) > 0 || len(pc.LabelPrefixes) > 0 || len(pc.Annotations) > 0 || len(pc.AnnotationPrefixes) > 0
+}
+
+// PropagatesLabel returns true if the label with the given key is propagated
+func (pc PropagationConfig) PropagatesLabel(key string) bool {
+	return matchesKey(key, pc.Labels, pc.LabelPrefixes)
+}
+
+// PropagatesAnnotation returns true if the annotation with the given key is propagated
+func (pc PropagationConfig) PropagatesAnnotation(key string) bool {
+	return matchesKey(key, pc.Annotations, pc.AnnotationPrefixes)
+}
+
+func matchesKey(key string, keys, prefixes []string) bool {
+	return util.ContainsBy(keys, func(k string) bool { return k == key }) ||
+		util.ContainsBy(prefixes, func(p string) bool { return strings.HasPrefix(key, p) })
+}
+
+// GetPropagationConfig returns the globally configured propagation of labels and
+// annotations from the custom resources to the resources they own
+func GetPropagationConfig() PropagationConfig { return config.propagation }
+
+// SetPropagationConfig globally configures the propagation of labels and annotations from
+// the custom resources to the resources they own. Propagation is disabled by default.
+func SetPropagationConfig(cfg PropagationConfig) { config.propagation = cfg }
+
 // GetDefaultReconcileConfigForGVK returns the default configuration that instructs basereconciler how to reconcile
 // a given kubernetes GVK (GroupVersionKind). This default config will be used if the "resource.Template" object (see
 // the resource package) does not specify a configuration itself.
@@ -113,3 +113,39 @@ func TestSetDefaultReconcileConfigForGVK(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadImageOverridesFromEnv(t *testing.T) {
+	defer SetImageOverrides(GetImageOverrides())
+	SetImageOverrides(map[string]string{"quay.io/3scale/system:1.0.0": "quay.io/3scale/system:1.0.1"})
+	t.Setenv("RELATED_IMAGE_APICAST", "registry.example.com/3scale/apicast@sha256:1234")
+	t.Setenv("RELATED_IMAGE_EMPTY", "")
+	t.Setenv("RELATED_IMAGE_BACKEND", "mirror.example.com/3scale/backend@sha256:5678")
+
+	LoadImageOverridesFromEnv(RelatedImage{Name: "BACKEND", Image: "quay.io/3scale/apisonator"})
+
+	tests := []struct {
+		name   string
+		image  string
+		want   string
+		wantOk bool
+	}{
+		{name: "Overrides images of the same repository", image: "registry.example.com/3scale/apicast:latest",
+			want: "registry.example.com/3scale/apicast@sha256:1234", wantOk: true},
+		{name: "Overrides the explicitly mapped image from a different registry", image: "quay.io/3scale/apisonator:v3",
+			want: "mirror.example.com/3scale/backend@sha256:5678", wantOk: true},
+		{name: "Does not override the repository of explicitly mapped images", image: "mirror.example.com/3scale/backend:v3",
+			want: "", wantOk: false},
+		{name: "Keeps configured overrides", image: "quay.io/3scale/system:1.0.0",
+			want: "quay.io/3scale/system:1.0.1", wantOk: true},
+		{name: "Does not override other images", image: "quay.io/3scale/system:2.0.0",
+			want: "", wantOk: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := GetImageOverride(tt.image)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("GetImageOverride() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,347 @@
+package mutators
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/3scale-ops/basereconciler/util"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultCAValidity is the default validity of the certificates generated by SelfSignedCA
+	DefaultCAValidity = 5 * 365 * 24 * time.Hour
+	// DefaultCertificateValidity is the default validity of the certificates generated
+	// by ServingCertificate
+	DefaultCertificateValidity = 365 * 24 * time.Hour
+	// CACertKey is the key of the CA certificate in the Secrets generated
+	// by SelfSignedCA and ServingCertificate
+	CACertKey = "ca.crt"
+)
+
+// SelfSignedCA generates a self-signed CA certificate into a "kubernetes.io/tls" Secret, under the
+// "tls.crt", "tls.key" and "ca.crt" keys. The CA is generated when the Secret does not exist or holds an
+// invalid certificate, and is rotated when it is about to expire (see RenewBefore). Otherwise, the live
+// certificate is kept. The "ca.crt" key holds the trust bundle: the current CA certificate followed by
+// the previous ones until they expire, so the certificates signed by a rotated CA are still trusted
+// while they are being replaced. The CA is meant to sign the certificates generated by ServingCertificate, for
+// webhooks or mTLS between components, without requiring cert-manager. As certificates are only rotated
+// when the owner is reconciled, the controller should requeue the owner periodically.
+// Example usage:
+//
+//	&resource.Template[*corev1.Secret]{
+//		TemplateBuilder: func(client.Object) (*corev1.Secret, error) {
+//			return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: ns}, Type: corev1.SecretTypeTLS}, nil
+//		},
+//		IsEnabled: true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.SelfSignedCA{CommonName: "my-operator-ca"}.Add(),
+//		},
+//	},
+type SelfSignedCA struct {
+	// CommonName is the common name of the CA certificate
+	CommonName string
+	// Validity is the validity of the CA certificate. Defaults to DefaultCAValidity.
+	Validity time.Duration
+	// RenewBefore is how long before expiry the certificate is rotated.
+	// Defaults to a third of the validity.
+	RenewBefore time.Duration
+}
+
+// Add generates or rotates the CA certificate in the Secret
+func (ca SelfSignedCA) Add() resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		secret := desired.(*corev1.Secret)
+		validity, renewBefore := certificateTimes(ca.Validity, ca.RenewBefore, DefaultCAValidity)
+
+		live, err := getTLSSecret(ctx, cl, client.ObjectKeyFromObject(desired))
+		if err != nil {
+			return err
+		}
+		if live != nil {
+			cert, _, err := parseKeyPair(live.Data)
+			if err == nil && cert.IsCA && cert.Subject.CommonName == ca.CommonName &&
+				!needsRenewal(cert, renewBefore) {
+				setCertificateData(secret, live.Data[corev1.TLSCertKey], live.Data[corev1.TLSPrivateKeyKey],
+					caBundle(live.Data[corev1.TLSCertKey], live.Data[CACertKey]))
+				return nil
+			}
+		}
+
+		template := &x509.Certificate{
+			Subject:               pkix.Name{CommonName: ca.CommonName},
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		}
+		certPEM, keyPEM, err := generateCertificate(template, validity, nil, nil)
+		if err != nil {
+			return fmt.Errorf("unable to generate CA certificate: %w", err)
+		}
+		previous := []byte{}
+		if live != nil {
+			// keep trusting the rotated CA
+			previous = append(append(previous, live.Data[CACertKey]...), live.Data[corev1.TLSCertKey]...)
+		}
+		setCertificateData(secret, certPEM, keyPEM, caBundle(certPEM, previous))
+		return nil
+	}
+}
+
+// ServingCertificate generates a serving certificate, signed by the CA held in the given Secret (see
+// SelfSignedCA), into a "kubernetes.io/tls" Secret under the "tls.crt", "tls.key" and "ca.crt" keys. The
+// certificate is generated when the Secret does not exist, holds an invalid certificate, its DNS SANs differ
+// from the configured ones or it was not signed by the current CA (for example because the CA has been
+// rotated). It is also rotated when it is about to expire (see RenewBefore). Otherwise, the live certificate
+// is kept. The "ca.crt" key holds the trust bundle of the CA Secret, which includes the previous CA
+// certificates during a CA rotation. The CA Secret must be reconciled before the serving certificate Secret, so its template must come
+// first in the list of templates passed to the reconciler.
+// To restart the workloads that use the certificate when it is rotated, use a RolloutTrigger for the Secret:
+//
+//	&resource.Template[*corev1.Secret]{
+//		TemplateBuilder: func(client.Object) (*corev1.Secret, error) {
+//			return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "webhook-cert", Namespace: ns}, Type: corev1.SecretTypeTLS}, nil
+//		},
+//		IsEnabled: true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.ServingCertificate{
+//				CASecretName: "ca",
+//				DNSNames:     []string{"webhook", "webhook.ns.svc", "webhook.ns.svc.cluster.local"},
+//			}.Add(),
+//		},
+//	},
+//	&resource.Template[*appsv1.Deployment]{
+//		TemplateBuilder: webhook(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.RolloutTrigger{Name: "webhook-cert", SecretName: util.Pointer("webhook-cert")}.Add(),
+//		},
+//	},
+type ServingCertificate struct {
+	// CASecretName is the name of the Secret that holds the CA, in the same
+	// namespace as the serving certificate Secret
+	CASecretName string
+	// CommonName is the common name of the certificate. Defaults to the first DNS name.
+	CommonName string
+	// DNSNames are the DNS subject alternative names of the certificate
+	DNSNames []string
+	// Validity is the validity of the certificate. Defaults to DefaultCertificateValidity.
+	Validity time.Duration
+	// RenewBefore is how long before expiry the certificate is rotated.
+	// Defaults to a third of the validity.
+	RenewBefore time.Duration
+}
+
+// Add generates or rotates the serving certificate in the Secret
+func (sc ServingCertificate) Add() resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		secret := desired.(*corev1.Secret)
+		validity, renewBefore := certificateTimes(sc.Validity, sc.RenewBefore, DefaultCertificateValidity)
+
+		caSecret, err := getTLSSecret(ctx, cl, types.NamespacedName{Name: sc.CASecretName, Namespace: desired.GetNamespace()})
+		if err != nil {
+			return err
+		}
+		if caSecret == nil {
+			return fmt.Errorf("CA secret %s/%s not found", desired.GetNamespace(), sc.CASecretName)
+		}
+		caCert, caKey, err := parseKeyPair(caSecret.Data)
+		if err != nil {
+			return fmt.Errorf("unable to parse CA secret %s/%s: %w", desired.GetNamespace(), sc.CASecretName, err)
+		}
+		caPEM := caSecret.Data[CACertKey]
+		if len(caPEM) == 0 {
+			caPEM = caSecret.Data[corev1.TLSCertKey]
+		}
+
+		live, err := getTLSSecret(ctx, cl, client.ObjectKeyFromObject(desired))
+		if err != nil {
+			return err
+		}
+		if live != nil {
+			cert, _, err := parseKeyPair(live.Data)
+			if err == nil && cert.CheckSignatureFrom(caCert) == nil && equalNames(cert.DNSNames, sc.DNSNames) &&
+				!needsRenewal(cert, renewBefore) {
+				setCertificateData(secret, live.Data[corev1.TLSCertKey], live.Data[corev1.TLSPrivateKeyKey], caPEM)
+				return nil
+			}
+		}
+
+		cn := sc.CommonName
+		if cn == "" && len(sc.DNSNames) > 0 {
+			cn = sc.DNSNames[0]
+		}
+		template := &x509.Certificate{
+			Subject:     pkix.Name{CommonName: cn},
+			DNSNames:    sc.DNSNames,
+			KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		}
+		certPEM, keyPEM, err := generateCertificate(template, validity, caCert, caKey)
+		if err != nil {
+			return fmt.Errorf("unable to generate serving certificate: %w", err)
+		}
+		setCertificateData(secret, certPEM, keyPEM, caPEM)
+		return nil
+	}
+}
+
+// certificateTimes returns the validity and renewal times,
+// applying the defaults if required
+func certificateTimes(validity, renewBefore, defaultValidity time.Duration) (time.Duration, time.Duration) {
+	if validity <= 0 {
+		validity = defaultValidity
+	}
+	if renewBefore <= 0 {
+		renewBefore = validity / 3
+	}
+	return validity, renewBefore
+}
+
+// needsRenewal returns true if the certificate expires within renewBefore
+func needsRenewal(cert *x509.Certificate, renewBefore time.Duration) bool {
+	return time.Now().Add(renewBefore).After(cert.NotAfter)
+}
+
+// getTLSSecret returns the Secret with the given key, or nil if it does not exist. The
+// Secret is read directly from the API server when available (see resource.APIReaderFrom),
+// as reading a stale Secret from the cache would cause the certificates to be regenerated.
+func getTLSSecret(ctx context.Context, cl client.Client, key types.NamespacedName) (*corev1.Secret, error) {
+	secret := &corev1.Secret{}
+	if err := resource.APIReaderFrom(ctx, cl).Get(ctx, key, secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to retrieve secret %s: %w", key, err)
+	}
+	return secret, nil
+}
+
+// setCertificateData sets the certificate, key and CA in the Secret
+func setCertificateData(secret *corev1.Secret, cert, key, ca []byte) {
+	secret.Type = corev1.SecretTypeTLS
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data[corev1.TLSCertKey] = cert
+	secret.Data[corev1.TLSPrivateKeyKey] = key
+	secret.Data[CACertKey] = ca
+}
+
+// caBundle returns the PEM encoded trust bundle with the CA certificate followed by the CA
+// certificates in the previous bundle that have not expired yet, without duplicates
+func caBundle(caPEM, previous []byte) []byte {
+	bundle := append([]byte{}, caPEM...)
+	seen := [][]byte{}
+	if block, _ := pem.Decode(caPEM); block != nil {
+		seen = append(seen, block.Bytes)
+	}
+	for rest := previous; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" || util.ContainsBy(seen, func(der []byte) bool { return bytes.Equal(der, block.Bytes) }) {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil || !cert.IsCA || time.Now().After(cert.NotAfter) {
+			continue
+		}
+		seen = append(seen, block.Bytes)
+		bundle = append(bundle, pem.EncodeToMemory(block)...)
+	}
+	return bundle
+}
+
+// parseKeyPair parses the certificate and private key held in the data of a TLS Secret
+func parseKeyPair(data map[string][]byte) (*x509.Certificate, crypto.Signer, error) {
+	certBlock, _ := pem.Decode(data[corev1.TLSCertKey])
+	if certBlock == nil {
+		return nil, nil, fmt.Errorf("unable to decode certificate")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBlock, _ := pem.Decode(data[corev1.TLSPrivateKeyKey])
+	if keyBlock == nil {
+		return nil, nil, fmt.Errorf("unable to decode private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported private key type")
+	}
+	return cert, signer, nil
+}
+
+// generateCertificate generates a new ECDSA key and a certificate for it using the given
+// template. The certificate is signed by the parent, or self-signed if the parent is nil.
+// The PEM encoded certificate and key are returned.
+func generateCertificate(template *x509.Certificate, validity time.Duration,
+	parent *x509.Certificate, parentKey crypto.Signer) ([]byte, []byte, error) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	template.SerialNumber = serial
+	// allow some clock skew
+	template.NotBefore = now.Add(-5 * time.Minute)
+	template.NotAfter = now.Add(validity)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), nil
+}
+
+// equalNames returns true if both lists contain the same names, in any order
+func equalNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string{}, a...), append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
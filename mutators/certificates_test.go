@@ -0,0 +1,246 @@
+package mutators
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func testCASecret(t *testing.T, name string, validity time.Duration) *corev1.Secret {
+	t.Helper()
+	certPEM, keyPEM, err := generateCertificate(&x509.Certificate{
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}, validity, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM, CACertKey: certPEM},
+	}
+}
+
+func testServingSecret(t *testing.T, ca *corev1.Secret, dnsNames []string, validity time.Duration) *corev1.Secret {
+	t.Helper()
+	caCert, caKey, err := parseKeyPair(ca.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := generateCertificate(&x509.Certificate{DNSNames: dnsNames}, validity, caCert, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "cert", Namespace: "ns"},
+		Type:       corev1.SecretTypeTLS,
+		Data:       map[string][]byte{corev1.TLSCertKey: certPEM, corev1.TLSPrivateKeyKey: keyPEM, CACertKey: ca.Data[corev1.TLSCertKey]},
+	}
+}
+
+func TestSelfSignedCA_Add(t *testing.T) {
+	valid := testCASecret(t, "ca", time.Hour*24*365)
+	expiring := testCASecret(t, "ca", time.Hour)
+
+	tests := []struct {
+		name       string
+		cl         client.Client
+		wantNew    bool
+		wantBundle []*corev1.Secret
+	}{
+		{
+			name:    "Generates the CA when the Secret does not exist",
+			cl:      fake.NewClientBuilder().Build(),
+			wantNew: true,
+		},
+		{
+			name:    "Keeps the live CA",
+			cl:      fake.NewClientBuilder().WithObjects(valid).Build(),
+			wantNew: false,
+		},
+		{
+			name:       "Rotates the CA before expiry",
+			cl:         fake.NewClientBuilder().WithObjects(expiring).Build(),
+			wantNew:    true,
+			wantBundle: []*corev1.Secret{expiring},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "ns"}}
+			live := &corev1.Secret{}
+			_ = tt.cl.Get(context.TODO(), client.ObjectKeyFromObject(desired), live)
+
+			if err := (SelfSignedCA{CommonName: "test-ca", Validity: time.Hour * 24 * 30}).Add()(context.TODO(), tt.cl, desired); err != nil {
+				t.Fatalf("SelfSignedCA.Add() error = %v", err)
+			}
+			cert, _, err := parseKeyPair(desired.Data)
+			if err != nil {
+				t.Fatalf("SelfSignedCA.Add() invalid certificate: %v", err)
+			}
+			if !cert.IsCA || cert.Subject.CommonName != "test-ca" {
+				t.Errorf("SelfSignedCA.Add() got certificate %v", cert.Subject)
+			}
+			want := append([]byte{}, desired.Data[corev1.TLSCertKey]...)
+			for _, previous := range tt.wantBundle {
+				want = append(want, previous.Data[corev1.TLSCertKey]...)
+			}
+			if desired.Type != corev1.SecretTypeTLS || !bytes.Equal(desired.Data[CACertKey], want) {
+				t.Errorf("SelfSignedCA.Add() got unexpected secret %v", desired)
+			}
+			if gotNew := !bytes.Equal(desired.Data[corev1.TLSCertKey], live.Data[corev1.TLSCertKey]); gotNew != tt.wantNew {
+				t.Errorf("SelfSignedCA.Add() generated new certificate = %v, want %v", gotNew, tt.wantNew)
+			}
+		})
+	}
+}
+
+func TestSelfSignedCA_Add_rotation(t *testing.T) {
+	cl := fake.NewClientBuilder().WithObjects(testCASecret(t, "ca", time.Hour)).Build()
+	ca := SelfSignedCA{CommonName: "test-ca", Validity: time.Hour * 24 * 30}
+	key := client.ObjectKey{Name: "ca", Namespace: "ns"}
+	old := &corev1.Secret{}
+	if err := cl.Get(context.TODO(), key, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// rotate the CA and issue a certificate with it
+	desired := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "ns"}}
+	if err := ca.Add()(context.TODO(), cl, desired); err != nil {
+		t.Fatalf("SelfSignedCA.Add() error = %v", err)
+	}
+	if err := cl.Update(context.TODO(), desired); err != nil {
+		t.Fatal(err)
+	}
+	cert := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "cert", Namespace: "ns"}}
+	if err := (ServingCertificate{CASecretName: "ca", DNSNames: []string{"svc"}}).Add()(context.TODO(), cl, cert); err != nil {
+		t.Fatalf("ServingCertificate.Add() error = %v", err)
+	}
+
+	// both CAs are trusted during the rotation
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(cert.Data[CACertKey]) {
+		t.Fatalf("ServingCertificate.Add() got invalid ca.crt")
+	}
+	for name, secret := range map[string]*corev1.Secret{"old": old, "new": desired} {
+		signed, _, err := parseKeyPair(testServingSecret(t, secret, []string{"svc"}, time.Hour).Data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := signed.Verify(x509.VerifyOptions{DNSName: "svc", Roots: pool}); err != nil {
+			t.Errorf("ServingCertificate.Add() ca.crt does not trust the %s CA: %v", name, err)
+		}
+	}
+
+	// the rotated CA is kept in the bundle in the following reconciles
+	again := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "ns"}}
+	if err := ca.Add()(context.TODO(), cl, again); err != nil {
+		t.Fatalf("SelfSignedCA.Add() error = %v", err)
+	}
+	if !bytes.Equal(again.Data[CACertKey], desired.Data[CACertKey]) {
+		t.Errorf("SelfSignedCA.Add() did not keep the trust bundle")
+	}
+}
+
+func TestSelfSignedCA_Add_staleCache(t *testing.T) {
+	live := testCASecret(t, "ca", time.Hour*24*365)
+	// the Secret has been created but the cache has not caught up yet
+	cl := fake.NewClientBuilder().Build()
+	ctx := resource.ContextWithAPIReader(context.TODO(), fake.NewClientBuilder().WithObjects(live).Build())
+
+	desired := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "ca", Namespace: "ns"}}
+	if err := (SelfSignedCA{CommonName: "test-ca", Validity: time.Hour * 24 * 30}).Add()(ctx, cl, desired); err != nil {
+		t.Fatalf("SelfSignedCA.Add() error = %v", err)
+	}
+	if !bytes.Equal(desired.Data[corev1.TLSCertKey], live.Data[corev1.TLSCertKey]) {
+		t.Errorf("SelfSignedCA.Add() generated a new certificate, want the live one")
+	}
+}
+
+func TestServingCertificate_Add(t *testing.T) {
+	ca := testCASecret(t, "ca", time.Hour*24*365)
+	otherCA := testCASecret(t, "ca", time.Hour*24*365)
+	dnsNames := []string{"svc", "svc.ns.svc"}
+
+	tests := []struct {
+		name    string
+		cl      client.Client
+		wantNew bool
+		wantErr bool
+	}{
+		{
+			name:    "Fails if the CA does not exist",
+			cl:      fake.NewClientBuilder().Build(),
+			wantErr: true,
+		},
+		{
+			name:    "Generates the certificate when the Secret does not exist",
+			cl:      fake.NewClientBuilder().WithObjects(ca).Build(),
+			wantNew: true,
+		},
+		{
+			name:    "Keeps the live certificate",
+			cl:      fake.NewClientBuilder().WithObjects(ca, testServingSecret(t, ca, []string{"svc.ns.svc", "svc"}, time.Hour*24*30)).Build(),
+			wantNew: false,
+		},
+		{
+			name:    "Rotates the certificate before expiry",
+			cl:      fake.NewClientBuilder().WithObjects(ca, testServingSecret(t, ca, dnsNames, time.Hour)).Build(),
+			wantNew: true,
+		},
+		{
+			name:    "Regenerates the certificate when the DNS names change",
+			cl:      fake.NewClientBuilder().WithObjects(ca, testServingSecret(t, ca, []string{"svc"}, time.Hour*24*30)).Build(),
+			wantNew: true,
+		},
+		{
+			name:    "Regenerates the certificate when the CA changes",
+			cl:      fake.NewClientBuilder().WithObjects(ca, testServingSecret(t, otherCA, dnsNames, time.Hour*24*30)).Build(),
+			wantNew: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			desired := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "cert", Namespace: "ns"}}
+			live := &corev1.Secret{}
+			_ = tt.cl.Get(context.TODO(), client.ObjectKeyFromObject(desired), live)
+
+			err := ServingCertificate{CASecretName: "ca", DNSNames: dnsNames, Validity: time.Hour * 24 * 30}.Add()(context.TODO(), tt.cl, desired)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ServingCertificate.Add() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			cert, _, err := parseKeyPair(desired.Data)
+			if err != nil {
+				t.Fatalf("ServingCertificate.Add() invalid certificate: %v", err)
+			}
+			caCert, _, _ := parseKeyPair(ca.Data)
+			if err := cert.CheckSignatureFrom(caCert); err != nil {
+				t.Errorf("ServingCertificate.Add() certificate not signed by CA: %v", err)
+			}
+			if !equalNames(cert.DNSNames, dnsNames) {
+				t.Errorf("ServingCertificate.Add() got DNS names %v", cert.DNSNames)
+			}
+			if !bytes.Equal(desired.Data[CACertKey], ca.Data[CACertKey]) {
+				t.Errorf("ServingCertificate.Add() got unexpected ca.crt")
+			}
+			if gotNew := !bytes.Equal(desired.Data[corev1.TLSCertKey], live.Data[corev1.TLSCertKey]); gotNew != tt.wantNew {
+				t.Errorf("ServingCertificate.Add() generated new certificate = %v, want %v", gotNew, tt.wantNew)
+			}
+		})
+	}
+}
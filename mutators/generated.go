@@ -0,0 +1,110 @@
+package mutators
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// InjectGeneratedNames replaces the references to the base names of the ConfigMaps and Secrets built by the given
+// generated templates (see resource.GeneratedTemplate) with their generated names, in the pod template of
+// Deployments, StatefulSets, DaemonSets, Jobs and CronJobs, or in the spec of Pods. References in volumes
+// (including projected volumes), envFrom, env valueFrom and imagePullSecrets are replaced. The generated templates
+// must come before the template that uses this mutation in the list passed to the reconciler, as the generated names
+// are only known once they have been built. Disabled generated templates are ignored.
+// Example usage:
+//
+//	cm := resource.NewGeneratedTemplate(config())
+//	templates := []resource.TemplateInterface{
+//		cm,
+//		resource.NewTemplate(deployment()).WithMutation(mutators.InjectGeneratedNames(cm)),
+//	}
+func InjectGeneratedNames(templates ...resource.TemplateWithGeneratedName) resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		var spec *corev1.PodSpec
+		if pod, ok := desired.(*corev1.Pod); ok {
+			spec = &pod.Spec
+		} else if tpl := podTemplate(desired); tpl != nil {
+			spec = &tpl.Spec
+		} else {
+			return nil
+		}
+
+		configMaps, secrets := map[string]string{}, map[string]string{}
+		for _, t := range templates {
+			if !t.Enabled() {
+				continue
+			}
+			if t.GetGeneratedName() == "" {
+				return fmt.Errorf("generated %s has not been built yet, its template must come before the templates referencing it",
+					t.GetGeneratedKind())
+			}
+			if t.GetGeneratedKind() == "Secret" {
+				secrets[t.GetBaseName()] = t.GetGeneratedName()
+			} else {
+				configMaps[t.GetBaseName()] = t.GetGeneratedName()
+			}
+		}
+
+		replace := func(names map[string]string, name *string) {
+			if generated, ok := names[*name]; ok {
+				*name = generated
+			}
+		}
+
+		for i := range spec.Volumes {
+			vol := &spec.Volumes[i]
+			if vol.Secret != nil {
+				replace(secrets, &vol.Secret.SecretName)
+			}
+			if vol.ConfigMap != nil {
+				replace(configMaps, &vol.ConfigMap.Name)
+			}
+			if vol.Projected != nil {
+				for j := range vol.Projected.Sources {
+					src := &vol.Projected.Sources[j]
+					if src.Secret != nil {
+						replace(secrets, &src.Secret.Name)
+					}
+					if src.ConfigMap != nil {
+						replace(configMaps, &src.ConfigMap.Name)
+					}
+				}
+			}
+		}
+
+		for _, containers := range [][]corev1.Container{spec.InitContainers, spec.Containers} {
+			for i := range containers {
+				c := &containers[i]
+				for j := range c.EnvFrom {
+					if c.EnvFrom[j].SecretRef != nil {
+						replace(secrets, &c.EnvFrom[j].SecretRef.Name)
+					}
+					if c.EnvFrom[j].ConfigMapRef != nil {
+						replace(configMaps, &c.EnvFrom[j].ConfigMapRef.Name)
+					}
+				}
+				for j := range c.Env {
+					if c.Env[j].ValueFrom == nil {
+						continue
+					}
+					if c.Env[j].ValueFrom.SecretKeyRef != nil {
+						replace(secrets, &c.Env[j].ValueFrom.SecretKeyRef.Name)
+					}
+					if c.Env[j].ValueFrom.ConfigMapKeyRef != nil {
+						replace(configMaps, &c.Env[j].ValueFrom.ConfigMapKeyRef.Name)
+					}
+				}
+			}
+		}
+
+		for i := range spec.ImagePullSecrets {
+			replace(secrets, &spec.ImagePullSecrets[i].Name)
+		}
+
+		return nil
+	}
+}
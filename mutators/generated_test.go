@@ -0,0 +1,67 @@
+package mutators
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestInjectGeneratedNames(t *testing.T) {
+	cl := fake.NewClientBuilder().Build()
+	cm := resource.NewGeneratedTemplate(func(client.Object) (*corev1.ConfigMap, error) {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "ns"}, Data: map[string]string{"a": "b"}}, nil
+	})
+	secret := resource.NewGeneratedTemplate(func(client.Object) (*corev1.Secret, error) {
+		return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}, Data: map[string][]byte{"a": []byte("b")}}, nil
+	})
+
+	deployment := func(cmName, secretName string) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "deploy", Namespace: "ns"},
+			Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{Name: "config", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: cmName}}}},
+					{Name: "other", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "other"}}}},
+				},
+				Containers: []corev1.Container{{
+					Name:    "container",
+					EnvFrom: []corev1.EnvFromSource{{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}}}},
+					Env: []corev1.EnvVar{{Name: "A", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: cmName}, Key: "a"}}}},
+				}},
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: secretName}},
+			}}},
+		}
+	}
+
+	t.Run("Fails if the generated templates have not been built", func(t *testing.T) {
+		if err := InjectGeneratedNames(cm, secret)(context.TODO(), cl, deployment("config", "secret")); err == nil {
+			t.Errorf("InjectGeneratedNames() expected error")
+		}
+	})
+
+	t.Run("Replaces the references with the generated names", func(t *testing.T) {
+		for _, template := range []resource.TemplateInterface{cm, secret} {
+			if _, err := template.Build(context.TODO(), cl, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := deployment("config", "secret")
+		if err := InjectGeneratedNames(cm, secret)(context.TODO(), cl, got); err != nil {
+			t.Fatalf("InjectGeneratedNames() error = %v", err)
+		}
+		want := deployment(cm.GetGeneratedName(), secret.GetGeneratedName())
+		if diff := cmp.Diff(got, want); len(diff) > 0 {
+			t.Errorf("InjectGeneratedNames() diff = %v", diff)
+		}
+	})
+}
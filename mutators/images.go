@@ -0,0 +1,90 @@
+package mutators
+
+import (
+	"context"
+
+	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// OverrideImages replaces the images of the containers, init containers and ephemeral containers
+// of the pod template of the workload with the globally configured image overrides (see config.SetImageOverrides
+// and config.LoadImageOverridesFromEnv). Deployments, StatefulSets, DaemonSets, Jobs, CronJobs, Pods and
+// unstructured objects are supported. For unstructured objects the pod template is looked up at the
+// given JSONPath, which defaults to DefaultPodTemplatePath. Each replaced image is logged.
+// Example usage:
+//
+//	&resource.Template[*appsv1.Deployment]{
+//		TemplateBuilder: deployment(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.OverrideImages(),
+//		},
+//	},
+func OverrideImages(podTemplatePath ...string) resource.TemplateMutationFunction {
+	var path string
+	if len(podTemplatePath) > 0 {
+		path = podTemplatePath[0]
+	}
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		logger := logr.FromContextOrDiscard(ctx).WithValues("resource", desired.GetName())
+		override := func(container string, image string) string {
+			if newImage, ok := config.GetImageOverride(image); ok && newImage != image {
+				logger.V(1).Info("overriding container image", "container", container, "image", image, "override", newImage)
+				return newImage
+			}
+			return image
+		}
+
+		var spec *corev1.PodSpec
+		if pod, ok := desired.(*corev1.Pod); ok {
+			spec = &pod.Spec
+		} else if tpl := podTemplate(desired); tpl != nil {
+			spec = &tpl.Spec
+		}
+		if spec != nil {
+			for i := range spec.Containers {
+				spec.Containers[i].Image = override(spec.Containers[i].Name, spec.Containers[i].Image)
+			}
+			for i := range spec.InitContainers {
+				spec.InitContainers[i].Image = override(spec.InitContainers[i].Name, spec.InitContainers[i].Image)
+			}
+			for i := range spec.EphemeralContainers {
+				spec.EphemeralContainers[i].Image = override(spec.EphemeralContainers[i].Name, spec.EphemeralContainers[i].Image)
+			}
+			return nil
+		}
+
+		u, ok := desired.(*unstructured.Unstructured)
+		if !ok {
+			return nil
+		}
+		tpl, err := unstructuredPodTemplate(u, path)
+		if err != nil {
+			return err
+		}
+		for _, field := range []string{"containers", "initContainers", "ephemeralContainers"} {
+			containers, _, _ := unstructured.NestedSlice(tpl, "spec", field)
+			for _, c := range containers {
+				container, ok := c.(map[string]any)
+				if !ok {
+					continue
+				}
+				if image, ok := container["image"].(string); ok {
+					name, _ := container["name"].(string)
+					container["image"] = override(name, image)
+				}
+			}
+			if len(containers) > 0 {
+				if err := unstructured.SetNestedSlice(tpl, containers, "spec", field); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,90 @@
+package mutators
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/config"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestOverrideImages(t *testing.T) {
+	defer config.SetImageOverrides(config.GetImageOverrides())
+	config.SetImageOverrides(map[string]string{
+		"quay.io/3scale/apicast":      "registry.example.com/apicast@sha256:1234",
+		"quay.io/3scale/system:1.0.0": "quay.io/3scale/system:1.0.1",
+	})
+
+	tests := []struct {
+		name    string
+		desired client.Object
+		want    client.Object
+		wantErr bool
+	}{
+		{
+			name: "Overrides images of a Deployment",
+			desired: &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				InitContainers:      []corev1.Container{{Name: "init", Image: "quay.io/3scale/system:1.0.0"}},
+				Containers:          []corev1.Container{{Name: "apicast", Image: "quay.io/3scale/apicast:latest"}, {Name: "other", Image: "other:latest"}},
+				EphemeralContainers: []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug", Image: "quay.io/3scale/apicast"}}},
+			}}}},
+			want: &appsv1.Deployment{Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				InitContainers:      []corev1.Container{{Name: "init", Image: "quay.io/3scale/system:1.0.1"}},
+				Containers:          []corev1.Container{{Name: "apicast", Image: "registry.example.com/apicast@sha256:1234"}, {Name: "other", Image: "other:latest"}},
+				EphemeralContainers: []corev1.EphemeralContainer{{EphemeralContainerCommon: corev1.EphemeralContainerCommon{Name: "debug", Image: "registry.example.com/apicast@sha256:1234"}}},
+			}}}},
+			wantErr: false,
+		},
+		{
+			name: "Overrides images of a CronJob",
+			desired: &batchv1.CronJob{Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "job", Image: "quay.io/3scale/system:1.0.0"}},
+				}}}}}},
+			want: &batchv1.CronJob{Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+				Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "job", Image: "quay.io/3scale/system:1.0.1"}},
+				}}}}}},
+			wantErr: false,
+		},
+		{
+			name: "Overrides images of unstructured objects",
+			desired: &unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+					"containers": []any{map[string]any{"name": "apicast", "image": "quay.io/3scale/apicast:v1"}},
+				}}},
+			}},
+			want: &unstructured.Unstructured{Object: map[string]any{
+				"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+					"containers": []any{map[string]any{"name": "apicast", "image": "registry.example.com/apicast@sha256:1234"}},
+				}}},
+			}},
+			wantErr: false,
+		},
+		{
+			name:    "Ignores other types",
+			desired: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc"}},
+			want:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc"}},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := OverrideImages()(context.TODO(), fake.NewClientBuilder().Build(), tt.desired)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("OverrideImages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.desired, tt.want); len(diff) > 0 {
+				t.Errorf("OverrideImages() diff = %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package mutators
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/ohler55/ojg/jp"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LiveFieldCondition decides if the live value of a field is copied into the desired
+// object. It receives the desired value, which is nil if the field is not present in
+// the desired object, and the live value.
+type LiveFieldCondition func(desired, live any) bool
+
+// IfDesiredEmpty is a LiveFieldCondition that copies the live value only if the
+// field is not present in the desired object or it holds an empty value
+func IfDesiredEmpty(desired, live any) bool {
+	if desired == nil {
+		return true
+	}
+	v := reflect.ValueOf(desired)
+	switch v.Kind() {
+	case reflect.Map, reflect.Slice:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// LiveField describes a field whose live value is copied into
+// the desired object (see PreserveLiveFieldsWith)
+type LiveField struct {
+	// Path is the JSONPath of the field. Wildcards are supported, in which case all the fields
+	// matched in the live object are copied to the same locations of the desired object. Items
+	// of lists are matched by position unless ListPath is set.
+	Path resource.Property
+	// ListPath is the JSONPath of a list whose items are identified by the values of ListKeys
+	// instead of by their position, like the ports of a Service, identified by "port" and "protocol".
+	// When set, Path is relative to each item of the list and the live values are copied into the
+	// desired item with the same keys.
+	ListPath resource.Property
+	// ListKeys are the fields that identify each item of the list at ListPath
+	ListKeys []string
+	// Condition decides if the live value is copied. The live value is always copied if nil.
+	Condition LiveFieldCondition
+}
+
+// PreserveLiveFields copies the values of the fields at the given JSONPaths from the live object
+// into the desired object, so the reconciler doesn't overwrite them. It works for any type of object.
+// See PreserveLiveFieldsWith for the details.
+// Example usage:
+//
+//	&resource.Template[*appsv1.Deployment]{
+//		TemplateBuilder: deployment(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.PreserveLiveFields("spec.replicas", "metadata.annotations['deployment.kubernetes.io/revision']"),
+//		},
+//	},
+func PreserveLiveFields(paths ...resource.Property) resource.TemplateMutationFunction {
+	fields := make([]LiveField, 0, len(paths))
+	for _, path := range paths {
+		fields = append(fields, LiveField{Path: path})
+	}
+	return PreserveLiveFieldsWith(fields...)
+}
+
+// PreserveLiveFieldsWith copies the values of the given fields from the live object into the
+// desired object. Only the fields present in the live object are copied, and list items that
+// don't exist in the desired object are skipped. Nothing is done if the live object does not exist.
+// Example usage, equivalent to the nodePort handling of SetServiceLiveValues:
+//
+//	&resource.Template[*corev1.Service]{
+//		TemplateBuilder: service(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.PreserveLiveFieldsWith(
+//				mutators.LiveField{Path: "spec.clusterIP"},
+//				mutators.LiveField{
+//					ListPath:  "spec.ports",
+//					ListKeys:  []string{"port", "protocol"},
+//					Path:      "nodePort",
+//					Condition: mutators.IfDesiredEmpty,
+//				},
+//			),
+//		},
+//	},
+func PreserveLiveFieldsWith(fields ...LiveField) resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		live, err := getLiveObject(ctx, cl, desired)
+		if err != nil || live == nil {
+			return err
+		}
+
+		u_desired, err := runtime.DefaultUnstructuredConverter.ToUnstructured(desired)
+		if err != nil {
+			return fmt.Errorf("unable to convert desired to unstructured: %w", err)
+		}
+		u_live, err := runtime.DefaultUnstructuredConverter.ToUnstructured(live)
+		if err != nil {
+			return fmt.Errorf("unable to convert live to unstructured: %w", err)
+		}
+
+		for _, field := range fields {
+			if err := field.preserve(u_desired, u_live); err != nil {
+				return err
+			}
+		}
+
+		// reset the desired object so fields removed from
+		// the unstructured representation are also removed
+		reflect.ValueOf(desired).Elem().Set(reflect.Zero(reflect.TypeOf(desired).Elem()))
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u_desired, desired); err != nil {
+			return fmt.Errorf("unable to convert unstructured to desired: %w", err)
+		}
+		return nil
+	}
+}
+
+func (f LiveField) preserve(u_desired, u_live map[string]any) error {
+	expr, err := jp.ParseString(string(f.Path))
+	if err != nil {
+		return fmt.Errorf("unable to parse JSONPath '%s': %w", f.Path, err)
+	}
+	if f.ListPath == "" {
+		return f.copy(expr, u_desired, u_live)
+	}
+
+	listExpr, err := jp.ParseString(string(f.ListPath))
+	if err != nil {
+		return fmt.Errorf("unable to parse JSONPath '%s': %w", f.ListPath, err)
+	}
+	desiredList, _ := listExpr.First(u_desired).([]any)
+	liveList, _ := listExpr.First(u_live).([]any)
+	for _, desiredItem := range desiredList {
+		d, ok := desiredItem.(map[string]any)
+		if !ok {
+			continue
+		}
+		for _, liveItem := range liveList {
+			if l, ok := liveItem.(map[string]any); ok && f.matchKeys(d, l) {
+				if err := f.copy(expr, d, l); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// copy copies the values matched by expr in live into the same locations of desired
+func (f LiveField) copy(expr jp.Expr, desired, live map[string]any) error {
+	for _, loc := range expr.Locate(live, 0) {
+		liveVal := loc.First(live)
+		desiredVal, found := loc.FirstFound(desired)
+		if !found {
+			desiredVal = nil
+		}
+		if f.Condition != nil && !f.Condition(desiredVal, liveVal) {
+			continue
+		}
+		if !found && hasIndex(loc) {
+			// skip list items that don't exist in desired
+			if _, ok := loc[len(loc)-1].(jp.Nth); ok || len(loc) < 2 || !loc[:len(loc)-1].Has(desired) {
+				continue
+			}
+		}
+		if err := loc.Set(desired, runtime.DeepCopyJSONValue(liveVal)); err != nil {
+			return fmt.Errorf("unable to set value '%v' in JSONPath '%s': %w", liveVal, loc, err)
+		}
+	}
+	return nil
+}
+
+// matchKeys returns true if both list items have the same values for all the list keys
+func (f LiveField) matchKeys(desired, live map[string]any) bool {
+	for _, key := range f.ListKeys {
+		if !equality.Semantic.DeepEqual(desired[key], live[key]) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasIndex returns true if the JSONPath includes a list index
+func hasIndex(expr jp.Expr) bool {
+	for _, frag := range expr {
+		if _, ok := frag.(jp.Nth); ok {
+			return true
+		}
+	}
+	return false
+}
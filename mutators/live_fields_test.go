@@ -0,0 +1,196 @@
+package mutators
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/3scale-ops/basereconciler/util"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPreserveLiveFields(t *testing.T) {
+	type args struct {
+		paths   []resource.Property
+		cl      client.Client
+		desired client.Object
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    client.Object
+		wantErr bool
+	}{
+		{
+			name: "Copies live values",
+			args: args{
+				paths: []resource.Property{"spec.replicas", "metadata.annotations['example.com/key']"},
+				cl: fake.NewClientBuilder().WithObjects(
+					&appsv1.Deployment{
+						ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns",
+							Annotations: map[string]string{"example.com/key": "live"}},
+						Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](10)},
+					}).Build(),
+				desired: &appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"},
+					Spec:       appsv1.DeploymentSpec{Replicas: util.Pointer[int32](2)},
+				},
+			},
+			want: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns",
+					Annotations: map[string]string{"example.com/key": "live"}},
+				Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](10)},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Copies live values using wildcards",
+			args: args{
+				paths: []resource.Property{"spec.template.spec.containers[*].image"},
+				cl: fake.NewClientBuilder().WithObjects(
+					&appsv1.Deployment{
+						ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"},
+						Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+							Containers: []corev1.Container{{Name: "a", Image: "a:live"}, {Name: "b", Image: "b:live"}},
+						}}},
+					}).Build(),
+				desired: &appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"},
+					Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+						Containers: []corev1.Container{{Name: "a", Image: "a:desired"}},
+					}}},
+				},
+			},
+			want: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "a", Image: "a:live"}},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Copies live values of unstructured objects",
+			args: args{
+				paths: []resource.Property{"spec.field"},
+				cl: fake.NewClientBuilder().WithObjects(
+					&unstructured.Unstructured{Object: map[string]any{
+						"apiVersion": "example.com/v1", "kind": "Test",
+						"metadata": map[string]any{"name": "test", "namespace": "ns"},
+						"spec":     map[string]any{"field": "live"},
+					}}).Build(),
+				desired: &unstructured.Unstructured{Object: map[string]any{
+					"apiVersion": "example.com/v1", "kind": "Test",
+					"metadata": map[string]any{"name": "test", "namespace": "ns"},
+					"spec":     map[string]any{"field": "desired", "other": "desired"},
+				}},
+			},
+			want: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "example.com/v1", "kind": "Test",
+				"metadata": map[string]any{"name": "test", "namespace": "ns"},
+				"spec":     map[string]any{"field": "live", "other": "desired"},
+			}},
+			wantErr: false,
+		},
+		{
+			name: "Does nothing if the live object does not exist",
+			args: args{
+				paths: []resource.Property{"spec.replicas"},
+				cl:    fake.NewClientBuilder().Build(),
+				desired: &appsv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"},
+					Spec:       appsv1.DeploymentSpec{Replicas: util.Pointer[int32](2)},
+				},
+			},
+			want: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"},
+				Spec:       appsv1.DeploymentSpec{Replicas: util.Pointer[int32](2)},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Returns error for invalid paths",
+			args: args{
+				paths: []resource.Property{"spec.[[["},
+				cl: fake.NewClientBuilder().WithObjects(
+					&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"}}).Build(),
+				desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"}},
+			},
+			want:    &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PreserveLiveFields(tt.args.paths...)(context.TODO(), tt.args.cl, tt.args.desired)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PreserveLiveFields() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.args.desired, tt.want, util.IgnoreProperty("ResourceVersion")); len(diff) > 0 {
+				t.Errorf("PreserveLiveFields() diff = %v", diff)
+			}
+		})
+	}
+}
+
+func TestPreserveLiveFieldsWith(t *testing.T) {
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+			Spec: corev1.ServiceSpec{
+				Type:      corev1.ServiceTypeNodePort,
+				ClusterIP: "10.0.0.1",
+				Ports: []corev1.ServicePort{
+					{Name: "udp", Port: 53, Protocol: corev1.ProtocolUDP, NodePort: 30001},
+					{Name: "tcp", Port: 53, Protocol: corev1.ProtocolTCP, NodePort: 30002},
+					{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, NodePort: 30003},
+				},
+			},
+		}).Build()
+	desired := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeNodePort,
+			Ports: []corev1.ServicePort{
+				{Name: "tcp", Port: 53, Protocol: corev1.ProtocolTCP},
+				{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, NodePort: 31000},
+				{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+	want := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+		Spec: corev1.ServiceSpec{
+			Type:      corev1.ServiceTypeNodePort,
+			ClusterIP: "10.0.0.1",
+			Ports: []corev1.ServicePort{
+				{Name: "tcp", Port: 53, Protocol: corev1.ProtocolTCP, NodePort: 30002},
+				{Name: "http", Port: 80, Protocol: corev1.ProtocolTCP, NodePort: 31000},
+				{Name: "https", Port: 443, Protocol: corev1.ProtocolTCP},
+			},
+		},
+	}
+
+	err := PreserveLiveFieldsWith(
+		LiveField{Path: "spec.clusterIP"},
+		LiveField{
+			ListPath:  "spec.ports",
+			ListKeys:  []string{"port", "protocol"},
+			Path:      "nodePort",
+			Condition: IfDesiredEmpty,
+		},
+	)(context.TODO(), cl, desired)
+	if err != nil {
+		t.Fatalf("PreserveLiveFieldsWith() error = %v", err)
+	}
+	if diff := cmp.Diff(desired, want); len(diff) > 0 {
+		t.Errorf("PreserveLiveFieldsWith() diff = %v", diff)
+	}
+}
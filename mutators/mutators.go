@@ -5,8 +5,11 @@ import (
 	"fmt"
 
 	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/3scale-ops/basereconciler/util"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -15,7 +18,8 @@ import (
 // is set to true, the value in the template is enforce, overwritting the live value. If
 // the "enforce" is set to false, the live value obtained from the Kubernetes API is used.
 // In general, if the Deployment uses HorizontalPodAutoscaler or any other controller modifies
-// the number of replicas, enforce needs to be "false".
+// the number of replicas, enforce needs to be "false". See SetAutoscaledReplicas for a mutator
+// that detects the autoscalers automatically.
 // Example usage:
 //
 //	&resource.Template[*appsv1.Deployment]{
@@ -52,9 +56,17 @@ func SetDeploymentReplicas(enforce bool) resource.TemplateMutationFunction {
 // API to avoid overwriting them. These values are typically set the by the kube-controller-manager
 // (in some rare occasions the user might explicitly set them) and should not be modified by the
 // reconciler. The fields that this function keeps in sync with the live state are:
-//   - spec.clusterIP
-//   - spec.ClisterIPs
-//   - spec.pors[*].nodePort (when the Service type is not ClusterIP)
+//   - spec.clusterIP, spec.clusterIPs, spec.ipFamilies and spec.ipFamilyPolicy (when the
+//     Service type is not ExternalName)
+//   - spec.ports[*].nodePort (when the Service type is NodePort or LoadBalancer)
+//   - spec.healthCheckNodePort (when the Service type is LoadBalancer and spec.externalTrafficPolicy
+//     is Local)
+//   - spec.loadBalancerClass and spec.allocateLoadBalancerNodePorts (when the Service type is LoadBalancer)
+//
+// Values explicitly set in the template are respected, except for spec.clusterIP and spec.clusterIPs,
+// which are immutable. The live values of fields that don't apply to the Service type in the template
+// are never copied, so type transitions (for example from LoadBalancer to ClusterIP, which requires the
+// node ports to be cleared) are handled correctly.
 //
 // Example usage:
 //
@@ -77,20 +89,249 @@ func SetServiceLiveValues() resource.TemplateMutationFunction {
 			return fmt.Errorf("unable to retrieve live object: %w", err)
 		}
 
-		// Set runtime values in the resource:
-		// "/spec/clusterIP", "/spec/clusterIPs", "/spec/ports/*/nodePort"
-		svc.Spec.ClusterIP = live.Spec.ClusterIP
-		svc.Spec.ClusterIPs = live.Spec.ClusterIPs
+		svcType := svc.Spec.Type
+		if svcType == "" {
+			svcType = corev1.ServiceTypeClusterIP
+		}
+
+		// ExternalName Services don't have cluster IPs
+		if svcType == corev1.ServiceTypeExternalName {
+			svc.Spec.ClusterIP = ""
+			svc.Spec.ClusterIPs = nil
+			svc.Spec.IPFamilies = nil
+			svc.Spec.IPFamilyPolicy = nil
+		} else {
+			// Set runtime values in the resource:
+			// "/spec/clusterIP", "/spec/clusterIPs", "/spec/ipFamilies", "/spec/ipFamilyPolicy"
+			svc.Spec.ClusterIP = live.Spec.ClusterIP
+			svc.Spec.ClusterIPs = live.Spec.ClusterIPs
+			if len(svc.Spec.IPFamilies) == 0 {
+				svc.Spec.IPFamilies = live.Spec.IPFamilies
+			}
+			if svc.Spec.IPFamilyPolicy == nil {
+				svc.Spec.IPFamilyPolicy = live.Spec.IPFamilyPolicy
+			}
+		}
 
-		// For services that are not ClusterIP we need to populate the runtime values
-		// of NodePort for each port
-		if svc.Spec.Type != corev1.ServiceTypeClusterIP {
+		// Only NodePort and LoadBalancer Services have node ports,
+		// so they need to be cleared for other Service types
+		if svcType == corev1.ServiceTypeNodePort || svcType == corev1.ServiceTypeLoadBalancer {
 			for idx, port := range svc.Spec.Ports {
 				runtimePort := findPort(port.Port, port.Protocol, live.Spec.Ports)
-				if runtimePort != nil {
+				if runtimePort != nil && port.NodePort == 0 {
 					svc.Spec.Ports[idx].NodePort = runtimePort.NodePort
 				}
 			}
+		} else {
+			for idx := range svc.Spec.Ports {
+				svc.Spec.Ports[idx].NodePort = 0
+			}
+		}
+
+		if svcType == corev1.ServiceTypeLoadBalancer {
+			if svc.Spec.LoadBalancerClass == nil {
+				svc.Spec.LoadBalancerClass = live.Spec.LoadBalancerClass
+			}
+			if svc.Spec.AllocateLoadBalancerNodePorts == nil {
+				svc.Spec.AllocateLoadBalancerNodePorts = live.Spec.AllocateLoadBalancerNodePorts
+			}
+		} else {
+			svc.Spec.LoadBalancerClass = nil
+			svc.Spec.AllocateLoadBalancerNodePorts = nil
+		}
+
+		// The health check node port is only allocated for
+		// LoadBalancer Services with "Local" traffic policy
+		if svcType == corev1.ServiceTypeLoadBalancer &&
+			svc.Spec.ExternalTrafficPolicy == corev1.ServiceExternalTrafficPolicyLocal {
+			if svc.Spec.HealthCheckNodePort == 0 {
+				svc.Spec.HealthCheckNodePort = live.Spec.HealthCheckNodePort
+			}
+		} else {
+			svc.Spec.HealthCheckNodePort = 0
+		}
+
+		return nil
+	}
+}
+
+// SetPersistentVolumeClaimLiveValues retrieves the live values of the PersistentVolumeClaim spec
+// that are set by the Kubernetes API or the storage provisioner, or that cannot be modified once
+// set, to avoid overwriting them. The fields that this function keeps in sync with the live state are:
+//   - spec.volumeName
+//   - spec.storageClassName and spec.volumeMode (when not set in the template)
+//   - spec.resources.requests.storage (when the live value is greater than the one in the template,
+//     as volumes cannot be shrunk)
+//
+// Example usage:
+//
+//	&resource.Template[*corev1.PersistentVolumeClaim]{
+//		TemplateBuilder: pvc(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.SetPersistentVolumeClaimLiveValues(),
+//		},
+//	}
+func SetPersistentVolumeClaimLiveValues() resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+
+		pvc := desired.(*corev1.PersistentVolumeClaim)
+		live := &corev1.PersistentVolumeClaim{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("unable to retrieve live object: %w", err)
+		}
+
+		pvc.Spec.VolumeName = live.Spec.VolumeName
+		if pvc.Spec.StorageClassName == nil {
+			pvc.Spec.StorageClassName = live.Spec.StorageClassName
+		}
+		if pvc.Spec.VolumeMode == nil {
+			pvc.Spec.VolumeMode = live.Spec.VolumeMode
+		}
+
+		if liveSize, ok := live.Spec.Resources.Requests[corev1.ResourceStorage]; ok {
+			if size, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]; ok && liveSize.Cmp(size) > 0 {
+				pvc.Spec.Resources.Requests[corev1.ResourceStorage] = liveSize
+			}
+		}
+		return nil
+	}
+}
+
+// jobControllerLabels are the labels that the Kubernetes API adds
+// to the selector and the pod template of Jobs
+var jobControllerLabels = []string{
+	"controller-uid",
+	"batch.kubernetes.io/controller-uid",
+	"job-name",
+	"batch.kubernetes.io/job-name",
+}
+
+// SetJobLiveValues retrieves the live values of the Job spec that are generated by the Kubernetes
+// API, to avoid overwriting them. The fields that this function keeps in sync with the live state are:
+//   - spec.selector (when not set in the template)
+//   - the "controller-uid" and "job-name" labels of the pod template, and their "batch.kubernetes.io/"
+//     prefixed versions
+//
+// Example usage:
+//
+//	&resource.Template[*batchv1.Job]{
+//		TemplateBuilder: job(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.SetJobLiveValues(),
+//		},
+//	}
+func SetJobLiveValues() resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+
+		job := desired.(*batchv1.Job)
+		live := &batchv1.Job{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("unable to retrieve live object: %w", err)
+		}
+
+		if job.Spec.Selector == nil {
+			job.Spec.Selector = live.Spec.Selector
+		}
+		for _, key := range jobControllerLabels {
+			value, ok := live.Spec.Template.GetLabels()[key]
+			if !ok {
+				continue
+			}
+			if job.Spec.Template.Labels == nil {
+				job.Spec.Template.Labels = map[string]string{}
+			}
+			job.Spec.Template.Labels[key] = value
+		}
+		return nil
+	}
+}
+
+// SetIngressLiveValues retrieves the live values of the Ingress spec that are set by the
+// Kubernetes API or by the ingress controllers, to avoid overwriting them. The fields that this
+// function keeps in sync with the live state are:
+//   - spec.ingressClassName (when not set in the template, as it is set by the Kubernetes API
+//     when there is a default IngressClass)
+//
+// Example usage:
+//
+//	&resource.Template[*networkingv1.Ingress]{
+//		TemplateBuilder: ingress(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.SetIngressLiveValues(),
+//		},
+//	}
+func SetIngressLiveValues() resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+
+		ingress := desired.(*networkingv1.Ingress)
+		live := &networkingv1.Ingress{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("unable to retrieve live object: %w", err)
+		}
+
+		if ingress.Spec.IngressClassName == nil {
+			ingress.Spec.IngressClassName = live.Spec.IngressClassName
+		}
+		return nil
+	}
+}
+
+// SetServiceAccountTokenSecretLiveValues retrieves the values that the Kubernetes token controller
+// populates in ServiceAccount token Secrets ("kubernetes.io/service-account-token" type), to avoid
+// overwriting them. The fields that this function keeps in sync with the live state are:
+//   - the "token", "ca.crt" and "namespace" keys of the data
+//   - the "kubernetes.io/service-account.uid" annotation
+//
+// Secrets of other types are left unchanged.
+// Example usage:
+//
+//	&resource.Template[*corev1.Secret]{
+//		TemplateBuilder: tokenSecret(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.SetServiceAccountTokenSecretLiveValues(),
+//		},
+//	}
+func SetServiceAccountTokenSecretLiveValues() resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+
+		secret := desired.(*corev1.Secret)
+		if secret.Type != corev1.SecretTypeServiceAccountToken {
+			return nil
+		}
+		live := &corev1.Secret{}
+		if err := cl.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+			if errors.IsNotFound(err) {
+				return nil
+			}
+			return fmt.Errorf("unable to retrieve live object: %w", err)
+		}
+
+		for _, key := range []string{corev1.ServiceAccountTokenKey, corev1.ServiceAccountRootCAKey, corev1.ServiceAccountNamespaceKey} {
+			value, ok := live.Data[key]
+			if !ok {
+				continue
+			}
+			if secret.Data == nil {
+				secret.Data = map[string][]byte{}
+			}
+			secret.Data[key] = value
+		}
+		if uid, ok := live.GetAnnotations()[corev1.ServiceAccountUIDKey]; ok {
+			secret.SetAnnotations(util.MergeMaps(map[string]string{}, secret.GetAnnotations(),
+				map[string]string{corev1.ServiceAccountUIDKey: uid}))
 		}
 		return nil
 	}
@@ -8,7 +8,10 @@ import (
 	"github.com/3scale-ops/basereconciler/util"
 	"github.com/google/go-cmp/cmp"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/kubernetes/scheme"
@@ -279,6 +282,126 @@ func Test_SetServiceLiveValues(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Populates the runtime fields (dual-stack LoadBalancer)",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+					&corev1.Service{
+						ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+						Spec: corev1.ServiceSpec{
+							Type:                          corev1.ServiceTypeLoadBalancer,
+							ClusterIP:                     "1.1.1.1",
+							ClusterIPs:                    []string{"1.1.1.1", "fd00::1"},
+							IPFamilies:                    []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol},
+							IPFamilyPolicy:                util.Pointer(corev1.IPFamilyPolicyPreferDualStack),
+							ExternalTrafficPolicy:         corev1.ServiceExternalTrafficPolicyLocal,
+							HealthCheckNodePort:           3000,
+							LoadBalancerClass:             util.Pointer("example.com/lb"),
+							AllocateLoadBalancerNodePorts: util.Pointer(true),
+							Ports: []corev1.ServicePort{{
+								Name: "port", Port: 80, TargetPort: intstr.FromInt(80), Protocol: corev1.ProtocolTCP, NodePort: 3333}},
+						},
+					}).Build(),
+				desired: &corev1.Service{
+					ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+					Spec: corev1.ServiceSpec{
+						Type:                  corev1.ServiceTypeLoadBalancer,
+						ExternalTrafficPolicy: corev1.ServiceExternalTrafficPolicyLocal,
+						Ports: []corev1.ServicePort{{
+							Name: "port", Port: 80, TargetPort: intstr.FromInt(80), Protocol: corev1.ProtocolTCP}},
+					},
+				},
+			},
+			want: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+				Spec: corev1.ServiceSpec{
+					Type:                          corev1.ServiceTypeLoadBalancer,
+					ClusterIP:                     "1.1.1.1",
+					ClusterIPs:                    []string{"1.1.1.1", "fd00::1"},
+					IPFamilies:                    []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol},
+					IPFamilyPolicy:                util.Pointer(corev1.IPFamilyPolicyPreferDualStack),
+					ExternalTrafficPolicy:         corev1.ServiceExternalTrafficPolicyLocal,
+					HealthCheckNodePort:           3000,
+					LoadBalancerClass:             util.Pointer("example.com/lb"),
+					AllocateLoadBalancerNodePorts: util.Pointer(true),
+					Ports: []corev1.ServicePort{{
+						Name: "port", Port: 80, TargetPort: intstr.FromInt(80), Protocol: corev1.ProtocolTCP, NodePort: 3333}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Populates the runtime fields (LoadBalancer to ClusterIP transition)",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+					&corev1.Service{
+						ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+						Spec: corev1.ServiceSpec{
+							Type:                          corev1.ServiceTypeLoadBalancer,
+							ClusterIP:                     "1.1.1.1",
+							ClusterIPs:                    []string{"1.1.1.1"},
+							ExternalTrafficPolicy:         corev1.ServiceExternalTrafficPolicyLocal,
+							HealthCheckNodePort:           3000,
+							AllocateLoadBalancerNodePorts: util.Pointer(true),
+							Ports: []corev1.ServicePort{{
+								Name: "port", Port: 80, TargetPort: intstr.FromInt(80), Protocol: corev1.ProtocolTCP, NodePort: 3333}},
+						},
+					}).Build(),
+				desired: &corev1.Service{
+					ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+					Spec: corev1.ServiceSpec{
+						Type: corev1.ServiceTypeClusterIP,
+						Ports: []corev1.ServicePort{{
+							Name: "port", Port: 80, TargetPort: intstr.FromInt(80), Protocol: corev1.ProtocolTCP, NodePort: 3333}},
+					},
+				},
+			},
+			want: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+				Spec: corev1.ServiceSpec{
+					Type:       corev1.ServiceTypeClusterIP,
+					ClusterIP:  "1.1.1.1",
+					ClusterIPs: []string{"1.1.1.1"},
+					Ports: []corev1.ServicePort{{
+						Name: "port", Port: 80, TargetPort: intstr.FromInt(80), Protocol: corev1.ProtocolTCP}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Populates the runtime fields (ClusterIP to ExternalName transition)",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+					&corev1.Service{
+						ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+						Spec: corev1.ServiceSpec{
+							Type:           corev1.ServiceTypeClusterIP,
+							ClusterIP:      "1.1.1.1",
+							ClusterIPs:     []string{"1.1.1.1"},
+							IPFamilies:     []corev1.IPFamily{corev1.IPv4Protocol},
+							IPFamilyPolicy: util.Pointer(corev1.IPFamilyPolicySingleStack),
+						},
+					}).Build(),
+				desired: &corev1.Service{
+					ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+					Spec: corev1.ServiceSpec{
+						Type:         corev1.ServiceTypeExternalName,
+						ExternalName: "example.com",
+					},
+				},
+			},
+			want: &corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"},
+				Spec: corev1.ServiceSpec{
+					Type:         corev1.ServiceTypeExternalName,
+					ExternalName: "example.com",
+				},
+			},
+			wantErr: false,
+		},
 		{
 			name: "Populates the runtime fields (does not fail if Service not found)",
 			args: args{
@@ -379,3 +502,270 @@ func Test_findPort(t *testing.T) {
 		})
 	}
 }
+
+func TestSetPersistentVolumeClaimLiveValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		cl      client.Client
+		desired *corev1.PersistentVolumeClaim
+		want    *corev1.PersistentVolumeClaim
+		wantErr bool
+	}{
+		{
+			name: "Populates the runtime fields",
+			cl: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+				&corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "ns"},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						VolumeName:       "pv",
+						StorageClassName: util.Pointer("standard"),
+						VolumeMode:       util.Pointer(corev1.PersistentVolumeFilesystem),
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}},
+					},
+				}).Build(),
+			desired: &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "ns"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}},
+				},
+			},
+			want: &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "ns"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					VolumeName:       "pv",
+					StorageClassName: util.Pointer("standard"),
+					VolumeMode:       util.Pointer(corev1.PersistentVolumeFilesystem),
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Respects the values in the template",
+			cl: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+				&corev1.PersistentVolumeClaim{
+					ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "ns"},
+					Spec: corev1.PersistentVolumeClaimSpec{
+						VolumeName:       "pv",
+						StorageClassName: util.Pointer("standard"),
+						Resources: corev1.VolumeResourceRequirements{
+							Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("1Gi")}},
+					},
+				}).Build(),
+			desired: &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "ns"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					StorageClassName: util.Pointer("fast"),
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}},
+				},
+			},
+			want: &corev1.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{Name: "pvc", Namespace: "ns"},
+				Spec: corev1.PersistentVolumeClaimSpec{
+					VolumeName:       "pv",
+					StorageClassName: util.Pointer("fast"),
+					Resources: corev1.VolumeResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")}},
+				},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetPersistentVolumeClaimLiveValues()(context.TODO(), tt.cl, tt.desired); (err != nil) != tt.wantErr {
+				t.Errorf("SetPersistentVolumeClaimLiveValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.desired, tt.want); len(diff) > 0 {
+				t.Errorf("SetPersistentVolumeClaimLiveValues() = diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestSetJobLiveValues(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"batch.kubernetes.io/controller-uid": "uid"}}
+	tests := []struct {
+		name    string
+		cl      client.Client
+		desired *batchv1.Job
+		want    *batchv1.Job
+		wantErr bool
+	}{
+		{
+			name: "Populates the runtime fields",
+			cl: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+				&batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns"},
+					Spec: batchv1.JobSpec{
+						Selector: selector,
+						Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+							"app":                                "job",
+							"controller-uid":                     "uid",
+							"batch.kubernetes.io/controller-uid": "uid",
+							"job-name":                           "job",
+							"batch.kubernetes.io/job-name":       "job",
+						}}},
+					},
+				}).Build(),
+			desired: &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns"},
+				Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "job"}}},
+				},
+			},
+			want: &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns"},
+				Spec: batchv1.JobSpec{
+					Selector: selector,
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{
+						"app":                                "job",
+						"controller-uid":                     "uid",
+						"batch.kubernetes.io/controller-uid": "uid",
+						"job-name":                           "job",
+						"batch.kubernetes.io/job-name":       "job",
+					}}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Does not fail if Job not found",
+			cl:   fake.NewClientBuilder().WithScheme(scheme.Scheme).Build(),
+			desired: &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns"},
+			},
+			want: &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns"},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetJobLiveValues()(context.TODO(), tt.cl, tt.desired); (err != nil) != tt.wantErr {
+				t.Errorf("SetJobLiveValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.desired, tt.want); len(diff) > 0 {
+				t.Errorf("SetJobLiveValues() = diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestSetIngressLiveValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		cl      client.Client
+		desired *networkingv1.Ingress
+		want    *networkingv1.Ingress
+		wantErr bool
+	}{
+		{
+			name: "Populates the runtime fields",
+			cl: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+				&networkingv1.Ingress{
+					ObjectMeta: metav1.ObjectMeta{Name: "ingress", Namespace: "ns"},
+					Spec:       networkingv1.IngressSpec{IngressClassName: util.Pointer("default")},
+				}).Build(),
+			desired: &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "ingress", Namespace: "ns"}},
+			want: &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "ingress", Namespace: "ns"},
+				Spec:       networkingv1.IngressSpec{IngressClassName: util.Pointer("default")},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Respects the values in the template",
+			cl: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+				&networkingv1.Ingress{
+					ObjectMeta: metav1.ObjectMeta{Name: "ingress", Namespace: "ns"},
+					Spec:       networkingv1.IngressSpec{IngressClassName: util.Pointer("default")},
+				}).Build(),
+			desired: &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "ingress", Namespace: "ns"},
+				Spec:       networkingv1.IngressSpec{IngressClassName: util.Pointer("nginx")},
+			},
+			want: &networkingv1.Ingress{
+				ObjectMeta: metav1.ObjectMeta{Name: "ingress", Namespace: "ns"},
+				Spec:       networkingv1.IngressSpec{IngressClassName: util.Pointer("nginx")},
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetIngressLiveValues()(context.TODO(), tt.cl, tt.desired); (err != nil) != tt.wantErr {
+				t.Errorf("SetIngressLiveValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.desired, tt.want); len(diff) > 0 {
+				t.Errorf("SetIngressLiveValues() = diff %s", diff)
+			}
+		})
+	}
+}
+
+func TestSetServiceAccountTokenSecretLiveValues(t *testing.T) {
+	live := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", Annotations: map[string]string{
+			"kubernetes.io/service-account.name": "sa",
+			"kubernetes.io/service-account.uid":  "uid",
+		}},
+		Type: corev1.SecretTypeServiceAccountToken,
+		Data: map[string][]byte{"token": []byte("token"), "ca.crt": []byte("ca"), "namespace": []byte("ns")},
+	}
+	tests := []struct {
+		name    string
+		cl      client.Client
+		desired *corev1.Secret
+		want    *corev1.Secret
+		wantErr bool
+	}{
+		{
+			name: "Populates the runtime fields",
+			cl:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(live.DeepCopy()).Build(),
+			desired: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", Annotations: map[string]string{
+					"kubernetes.io/service-account.name": "sa",
+				}},
+				Type: corev1.SecretTypeServiceAccountToken,
+			},
+			want: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns", Annotations: map[string]string{
+					"kubernetes.io/service-account.name": "sa",
+					"kubernetes.io/service-account.uid":  "uid",
+				}},
+				Type: corev1.SecretTypeServiceAccountToken,
+				Data: map[string][]byte{"token": []byte("token"), "ca.crt": []byte("ca"), "namespace": []byte("ns")},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Ignores other Secret types",
+			cl:   fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(live.DeepCopy()).Build(),
+			desired: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"},
+				Type:       corev1.SecretTypeOpaque,
+			},
+			want: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "token", Namespace: "ns"},
+				Type:       corev1.SecretTypeOpaque,
+			},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetServiceAccountTokenSecretLiveValues()(context.TODO(), tt.cl, tt.desired); (err != nil) != tt.wantErr {
+				t.Errorf("SetServiceAccountTokenSecretLiveValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.desired, tt.want); len(diff) > 0 {
+				t.Errorf("SetServiceAccountTokenSecretLiveValues() = diff %s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package mutators
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/3scale-ops/basereconciler/util"
+	"github.com/ohler55/ojg/jp"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultPodTemplatePath is the JSONPath used to locate the pod template
+// in unstructured objects when no other path is configured
+const DefaultPodTemplatePath = "spec.template"
+
+// podTemplate returns the pod template of the workload or nil if
+// the object is not of one of the supported workload types
+func podTemplate(o client.Object) *corev1.PodTemplateSpec {
+	switch o := o.(type) {
+	case *appsv1.Deployment:
+		return &o.Spec.Template
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template
+	case *batchv1.Job:
+		return &o.Spec.Template
+	case *batchv1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template
+	}
+	return nil
+}
+
+// unstructuredPodTemplate returns the pod template found at the given JSONPath
+// of the unstructured object. The returned map is part of the object, so modifications
+// to it are applied to the object.
+func unstructuredPodTemplate(u *unstructured.Unstructured, path string) (map[string]any, error) {
+	if path == "" {
+		path = DefaultPodTemplatePath
+	}
+	expr, err := jp.ParseString(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse pod template path '%s': %w", path, err)
+	}
+	for _, result := range expr.Get(u.Object) {
+		if tpl, ok := result.(map[string]any); ok {
+			return tpl, nil
+		}
+	}
+	return nil, fmt.Errorf("pod template not found at path '%s' in %s", path, u.GroupVersionKind())
+}
+
+// setPodTemplateAnnotations adds the annotations to the pod template of the workload. For
+// unstructured objects the pod template is looked up at the given JSONPath. Objects of other
+// types are left unchanged.
+func setPodTemplateAnnotations(o client.Object, path string, annotations map[string]string) error {
+	if tpl := podTemplate(o); tpl != nil {
+		tpl.ObjectMeta.Annotations = util.MergeMaps(map[string]string{}, tpl.ObjectMeta.Annotations, annotations)
+		return nil
+	}
+
+	u, ok := o.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+	tpl, err := unstructuredPodTemplate(u, path)
+	if err != nil {
+		return err
+	}
+	metadata, ok := tpl["metadata"].(map[string]any)
+	if !ok {
+		metadata = map[string]any{}
+		tpl["metadata"] = metadata
+	}
+	current, ok := metadata["annotations"].(map[string]any)
+	if !ok {
+		current = map[string]any{}
+		metadata["annotations"] = current
+	}
+	for k, v := range annotations {
+		current[k] = v
+	}
+	return nil
+}
+
+// getPodSpec returns the pod spec of the workload or nil if the object is not of one of the
+// supported workload types. For unstructured objects the pod template is looked up at the given
+// JSONPath and the returned pod spec is a copy, so modifications to it are not applied to the object.
+func getPodSpec(o client.Object, path string) (*corev1.PodSpec, error) {
+	if tpl := podTemplate(o); tpl != nil {
+		return &tpl.Spec, nil
+	}
+
+	u, ok := o.(*unstructured.Unstructured)
+	if !ok {
+		return nil, nil
+	}
+	tpl, err := unstructuredPodTemplate(u, path)
+	if err != nil {
+		return nil, err
+	}
+	typed := &corev1.PodTemplateSpec{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(tpl, typed); err != nil {
+		return nil, fmt.Errorf("unable to convert pod template: %w", err)
+	}
+	return &typed.Spec, nil
+}
+
+// livePodTemplateAnnotation returns the value of the annotation in the pod template
+// of the live object that corresponds to desired. An empty string is returned if the
+// live object or the annotation do not exist.
+func livePodTemplateAnnotation(ctx context.Context, cl client.Client, desired client.Object, path, key string) (string, error) {
+	live, err := getLiveObject(ctx, cl, desired)
+	if err != nil || live == nil {
+		return "", err
+	}
+
+	if tpl := podTemplate(live); tpl != nil {
+		return tpl.ObjectMeta.Annotations[key], nil
+	}
+	if lu, ok := live.(*unstructured.Unstructured); ok {
+		tpl, err := unstructuredPodTemplate(lu, path)
+		if err != nil {
+			return "", nil
+		}
+		value, _, _ := unstructured.NestedString(tpl, "metadata", "annotations", key)
+		return value, nil
+	}
+	return "", nil
+}
+
+// getLiveObject returns the live object that corresponds to desired, or nil if it
+// does not exist. The live object has the same type as desired.
+func getLiveObject(ctx context.Context, cl client.Client, desired client.Object) (client.Object, error) {
+	var live client.Object
+	if u, ok := desired.(*unstructured.Unstructured); ok {
+		lu := &unstructured.Unstructured{}
+		lu.SetGroupVersionKind(u.GroupVersionKind())
+		live = lu
+	} else {
+		live = reflect.New(reflect.TypeOf(desired).Elem()).Interface().(client.Object)
+	}
+	if err := cl.Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to retrieve live object: %w", err)
+	}
+	return live, nil
+}
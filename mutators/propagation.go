@@ -0,0 +1,61 @@
+package mutators
+
+import (
+	"context"
+
+	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// PropagateOwnerMetadata copies the labels and annotations of the owner that are selected in the global
+// propagation config (see config.SetPropagationConfig) to the desired object and, if enabled in the config,
+// to the pod template of Deployments, StatefulSets, DaemonSets, Jobs and CronJobs. Labels and annotations
+// set by the template take precedence over the propagated ones. As the keys removed from the owner are
+// not propagated anymore, they are also removed from the owned resources when these are reconciled.
+// The reconciler applies this mutation to all the owned resources when the propagation config is enabled,
+// so there is usually no need to use it directly.
+func PropagateOwnerMetadata(owner client.Object) resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		cfg := config.GetPropagationConfig()
+		labels := map[string]string{}
+		for k, v := range owner.GetLabels() {
+			if cfg.PropagatesLabel(k) {
+				labels[k] = v
+			}
+		}
+		annotations := map[string]string{}
+		for k, v := range owner.GetAnnotations() {
+			if cfg.PropagatesAnnotation(k) {
+				annotations[k] = v
+			}
+		}
+		if len(labels) == 0 && len(annotations) == 0 {
+			return nil
+		}
+
+		desired.SetLabels(mergeMissing(desired.GetLabels(), labels))
+		desired.SetAnnotations(mergeMissing(desired.GetAnnotations(), annotations))
+
+		if tpl := podTemplate(desired); tpl != nil && cfg.PodTemplates {
+			tpl.ObjectMeta.Labels = mergeMissing(tpl.ObjectMeta.Labels, labels)
+			tpl.ObjectMeta.Annotations = mergeMissing(tpl.ObjectMeta.Annotations, annotations)
+		}
+		return nil
+	}
+}
+
+// mergeMissing returns a copy of dst with the keys of src that are not present in dst
+func mergeMissing(dst, src map[string]string) map[string]string {
+	if len(src) == 0 {
+		return dst
+	}
+	merged := make(map[string]string, len(dst)+len(src))
+	for k, v := range src {
+		merged[k] = v
+	}
+	for k, v := range dst {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,84 @@
+package mutators
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/config"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestPropagateOwnerMetadata(t *testing.T) {
+	defer config.SetPropagationConfig(config.GetPropagationConfig())
+
+	owner := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns",
+		Labels:      map[string]string{"team": "a", "cost.example.com/center": "1", "other": "x"},
+		Annotations: map[string]string{"example.com/owner": "someone", "other": "x"},
+	}}
+
+	tests := []struct {
+		name    string
+		cfg     config.PropagationConfig
+		desired client.Object
+		want    client.Object
+	}{
+		{
+			name: "Propagates labels and annotations",
+			cfg: config.PropagationConfig{
+				Labels: []string{"team"}, LabelPrefixes: []string{"cost.example.com/"},
+				AnnotationPrefixes: []string{"example.com/"},
+			},
+			desired: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns",
+				Labels: map[string]string{"app": "svc"}}},
+			want: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns",
+				Labels:      map[string]string{"app": "svc", "team": "a", "cost.example.com/center": "1"},
+				Annotations: map[string]string{"example.com/owner": "someone"},
+			}},
+		},
+		{
+			name: "Template values take precedence",
+			cfg:  config.PropagationConfig{Labels: []string{"team"}},
+			desired: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns",
+				Labels: map[string]string{"team": "b"}}},
+			want: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns",
+				Labels: map[string]string{"team": "b"}}},
+		},
+		{
+			name: "Propagates to pod templates",
+			cfg:  config.PropagationConfig{Labels: []string{"team"}, PodTemplates: true},
+			desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "dep", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": "dep"}}}}},
+			want: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "dep", Namespace: "ns", Labels: map[string]string{"team": "a"}},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": "dep", "team": "a"}}}}},
+		},
+		{
+			name: "Does not propagate to pod templates unless enabled",
+			cfg:  config.PropagationConfig{Labels: []string{"team"}},
+			desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "dep", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": "dep"}}}}},
+			want: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "dep", Namespace: "ns", Labels: map[string]string{"team": "a"}},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Labels: map[string]string{"app": "dep"}}}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.SetPropagationConfig(tt.cfg)
+			if err := PropagateOwnerMetadata(owner)(context.TODO(), fake.NewClientBuilder().Build(), tt.desired); err != nil {
+				t.Errorf("PropagateOwnerMetadata() error = %v", err)
+				return
+			}
+			if diff := cmp.Diff(tt.desired, tt.want); len(diff) > 0 {
+				t.Errorf("PropagateOwnerMetadata() diff = %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package mutators
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// scaledObjectListGVK is the GroupVersionKind of KEDA ScaledObject lists
+var scaledObjectListGVK = schema.GroupVersionKind{Group: "keda.sh", Version: "v1alpha1", Kind: "ScaledObjectList"}
+
+// SetAutoscaledReplicas reconciles the number of replicas of a workload (Deployments, StatefulSets or any
+// other object with a "spec.replicas" field) taking into account the autoscalers that target it. If there is
+// a HorizontalPodAutoscaler or a KEDA ScaledObject whose scaleTargetRef points at the workload, the live value
+// is used so the reconciler does not fight with the autoscaler. Otherwise, the value in the template is
+// enforced, which means that the template value is restored when the autoscaler is removed. Unlike
+// SetDeploymentReplicas, the caller does not need to know if the workload is autoscaled.
+// ScaledObjects are ignored if the KEDA CRDs are not installed in the cluster. RBAC permissions to list
+// HorizontalPodAutoscalers (and ScaledObjects, if used) are required.
+// Example usage:
+//
+//	&resource.Template[*appsv1.StatefulSet]{
+//		TemplateBuilder: statefulset(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.SetAutoscaledReplicas(),
+//		},
+//	},
+func SetAutoscaledReplicas() resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		autoscaled, err := isAutoscaled(ctx, cl, desired)
+		if err != nil || !autoscaled {
+			return err
+		}
+		return PreserveLiveFields("spec.replicas")(ctx, cl, desired)
+	}
+}
+
+// isAutoscaled returns true if there is a HorizontalPodAutoscaler or
+// a KEDA ScaledObject in the namespace that targets the object
+func isAutoscaled(ctx context.Context, cl client.Client, o client.Object) (bool, error) {
+	gvk, err := apiutil.GVKForObject(o, cl.Scheme())
+	if err != nil {
+		return false, err
+	}
+
+	hpas := &autoscalingv2.HorizontalPodAutoscalerList{}
+	if err := cl.List(ctx, hpas, client.InNamespace(o.GetNamespace())); err != nil {
+		return false, fmt.Errorf("unable to list HorizontalPodAutoscalers: %w", err)
+	}
+	for _, hpa := range hpas.Items {
+		ref := hpa.Spec.ScaleTargetRef
+		if targets(ref.APIVersion, ref.Kind, ref.Name, gvk, o.GetName()) {
+			return true, nil
+		}
+	}
+
+	scaledObjects := &unstructured.UnstructuredList{}
+	scaledObjects.SetGroupVersionKind(scaledObjectListGVK)
+	if err := cl.List(ctx, scaledObjects, client.InNamespace(o.GetNamespace())); err != nil {
+		if meta.IsNoMatchError(err) || runtime.IsNotRegisteredError(err) {
+			// KEDA is not installed
+			return false, nil
+		}
+		return false, fmt.Errorf("unable to list ScaledObjects: %w", err)
+	}
+	for _, so := range scaledObjects.Items {
+		ref, _, _ := unstructured.NestedStringMap(so.Object, "spec", "scaleTargetRef")
+		// KEDA defaults the target to a Deployment
+		apiVersion, kind := ref["apiVersion"], ref["kind"]
+		if apiVersion == "" {
+			apiVersion = "apps/v1"
+		}
+		if kind == "" {
+			kind = "Deployment"
+		}
+		if targets(apiVersion, kind, ref["name"], gvk, o.GetName()) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// targets returns true if the scale target reference points at the object with the
+// given GroupVersionKind and name. The version is not taken into account.
+func targets(apiVersion, kind, name string, gvk schema.GroupVersionKind, objName string) bool {
+	gv, err := schema.ParseGroupVersion(apiVersion)
+	if err != nil {
+		return false
+	}
+	return gv.Group == gvk.Group && kind == gvk.Kind && name == objName
+}
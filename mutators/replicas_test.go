@@ -0,0 +1,103 @@
+package mutators
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/util"
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSetAutoscaledReplicas(t *testing.T) {
+	liveDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"},
+		Spec:       appsv1.DeploymentSpec{Replicas: util.Pointer[int32](10)},
+	}
+	liveStatefulSet := &appsv1.StatefulSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"},
+		Spec:       appsv1.StatefulSetSpec{Replicas: util.Pointer[int32](10)},
+	}
+	hpa := func(kind string) *autoscalingv2.HorizontalPodAutoscaler {
+		return &autoscalingv2.HorizontalPodAutoscaler{
+			ObjectMeta: metav1.ObjectMeta{Name: "hpa", Namespace: "ns"},
+			Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+				ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{APIVersion: "apps/v1", Kind: kind, Name: "workload"},
+			},
+		}
+	}
+	scaledObject := &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "keda.sh/v1alpha1", "kind": "ScaledObject",
+		"metadata": map[string]any{"name": "so", "namespace": "ns"},
+		"spec":     map[string]any{"scaleTargetRef": map[string]any{"name": "workload"}},
+	}}
+
+	tests := []struct {
+		name    string
+		cl      client.Client
+		desired client.Object
+		want    client.Object
+		wantErr bool
+	}{
+		{
+			name:    "Enforces the template value if there is no autoscaler",
+			cl:      fake.NewClientBuilder().WithObjects(liveDeployment.DeepCopy()).Build(),
+			desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](2)}},
+			want:    &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](2)}},
+			wantErr: false,
+		},
+		{
+			name:    "Uses the live value if a HorizontalPodAutoscaler targets the Deployment",
+			cl:      fake.NewClientBuilder().WithObjects(liveDeployment.DeepCopy(), hpa("Deployment")).Build(),
+			desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](2)}},
+			want:    &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](10)}},
+			wantErr: false,
+		},
+		{
+			name:    "Uses the live value if a HorizontalPodAutoscaler targets the StatefulSet",
+			cl:      fake.NewClientBuilder().WithObjects(liveStatefulSet.DeepCopy(), hpa("StatefulSet")).Build(),
+			desired: &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.StatefulSetSpec{Replicas: util.Pointer[int32](2)}},
+			want:    &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.StatefulSetSpec{Replicas: util.Pointer[int32](10)}},
+			wantErr: false,
+		},
+		{
+			name:    "Ignores HorizontalPodAutoscalers that target other kinds",
+			cl:      fake.NewClientBuilder().WithObjects(liveStatefulSet.DeepCopy(), hpa("Deployment")).Build(),
+			desired: &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.StatefulSetSpec{Replicas: util.Pointer[int32](2)}},
+			want:    &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.StatefulSetSpec{Replicas: util.Pointer[int32](2)}},
+			wantErr: false,
+		},
+		{
+			name:    "Uses the live value if a ScaledObject targets the Deployment",
+			cl:      fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(liveDeployment.DeepCopy(), scaledObject.DeepCopy()).Build(),
+			desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](2)}},
+			want:    &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](10)}},
+			wantErr: false,
+		},
+		{
+			name:    "Uses the template value if the workload does not exist",
+			cl:      fake.NewClientBuilder().WithObjects(hpa("Deployment")).Build(),
+			desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](2)}},
+			want:    &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "workload", Namespace: "ns"}, Spec: appsv1.DeploymentSpec{Replicas: util.Pointer[int32](2)}},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SetAutoscaledReplicas()(context.TODO(), tt.cl, tt.desired)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetAutoscaledReplicas() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.desired, tt.want); len(diff) > 0 {
+				t.Errorf("SetAutoscaledReplicas() diff = %v", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package mutators
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/resource"
+	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// RolloutRestartAnnotationKey returns the key of the annotation that requests a rollout
+// restart of the workloads owned by a custom resource, "<annotations-domain>/restartedAt".
+// The annotations domain can be passed as parameter, otherwise the globally configured
+// annotations domain is used.
+func RolloutRestartAnnotationKey(params ...string) string {
+	var domain string
+	if len(params) == 0 {
+		domain = config.GetAnnotationsDomain()
+	} else {
+		domain = params[0]
+	}
+	return fmt.Sprintf("%s/%s", domain, "restartedAt")
+}
+
+// RolloutRestart copies the rollout restart annotation (see RolloutRestartAnnotationKey) of the
+// owner to the pod template of the workload, so changing the value of the annotation in the
+// owner performs a rolling restart of the workload, the same way 'kubectl rollout restart' does.
+// Unlike a manual restart, the restart is not reverted by the reconciler as the annotation is part
+// of the template. Deployments, StatefulSets and DaemonSets are supported, other objects are left
+// unchanged. Removing the annotation from the owner also triggers a rollout.
+// Example usage:
+//
+//	&resource.Template[*appsv1.Deployment]{
+//		TemplateBuilder: deployment(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.RolloutRestart(instance),
+//		},
+//	},
+//
+// Then, to restart the workload:
+//
+//	kubectl annotate --overwrite test/instance basereconciler.3cale.net/restartedAt="$(date -Iseconds)"
+func RolloutRestart(owner client.Object, params ...string) resource.TemplateMutationFunction {
+	key := RolloutRestartAnnotationKey(params...)
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		switch desired.(type) {
+		case *appsv1.Deployment, *appsv1.StatefulSet, *appsv1.DaemonSet:
+		default:
+			return nil
+		}
+		value, ok := owner.GetAnnotations()[key]
+		if !ok || value == "" {
+			return nil
+		}
+		return setPodTemplateAnnotations(desired, "", map[string]string{key: value})
+	}
+}
@@ -0,0 +1,96 @@
+package mutators
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestRolloutRestart(t *testing.T) {
+	type args struct {
+		owner   client.Object
+		domain  string
+		desired client.Object
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    client.Object
+		wantErr bool
+	}{
+		{
+			name: "Copies the restart annotation to the Deployment's pods",
+			args: args{
+				owner: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns",
+					Annotations: map[string]string{"example.com/restartedAt": "2024-01-01T00:00:00Z"}}},
+				domain:  "example.com",
+				desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"}},
+			},
+			want: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"example.com/restartedAt": "2024-01-01T00:00:00Z"},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Copies the restart annotation to the DaemonSet's pods",
+			args: args{
+				owner: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns",
+					Annotations: map[string]string{"example.com/restartedAt": "2024-01-01T00:00:00Z"}}},
+				domain: "example.com",
+				desired: &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "ds", Namespace: "ns"},
+					Spec: appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+						Annotations: map[string]string{"key": "value"},
+					}}}},
+			},
+			want: &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "ds", Namespace: "ns"},
+				Spec: appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"key": "value", "example.com/restartedAt": "2024-01-01T00:00:00Z"},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Does nothing if the owner has no restart annotation",
+			args: args{
+				owner:   &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				domain:  "example.com",
+				desired: &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "sts", Namespace: "ns"}},
+			},
+			want:    &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "sts", Namespace: "ns"}},
+			wantErr: false,
+		},
+		{
+			name: "Ignores other types",
+			args: args{
+				owner: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns",
+					Annotations: map[string]string{"example.com/restartedAt": "2024-01-01T00:00:00Z"}}},
+				domain:  "example.com",
+				desired: &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}},
+			},
+			want:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := RolloutRestart(tt.args.owner, tt.args.domain)(context.TODO(), fake.NewClientBuilder().Build(), tt.args.desired)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RolloutRestart() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if diff := cmp.Diff(tt.args.desired, tt.want); len(diff) > 0 {
+				t.Errorf("RolloutRestart() diff = %v", diff)
+			}
+		})
+	}
+}
@@ -7,7 +7,7 @@ import (
 	"github.com/3scale-ops/basereconciler/config"
 	"github.com/3scale-ops/basereconciler/resource"
 	"github.com/3scale-ops/basereconciler/util"
-	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/types"
@@ -30,9 +30,18 @@ type RolloutTrigger struct {
 	Name          string
 	ConfigMapName *string
 	SecretName    *string
+	// Keys restricts the trigger to the given keys of the config source, so changes
+	// in other keys don't trigger a rollout. All keys are used if empty.
+	Keys []string
+	// PodTemplatePath is the JSONPath of the pod template in unstructured objects, like
+	// custom resources that manage pods (for example Argo Rollouts). Defaults to
+	// DefaultPodTemplatePath.
+	PodTemplatePath string
 }
 
-// Add adds the trigger to the Deployment/StatefulSet
+// Add adds the trigger to the pod template of the workload. Deployments, StatefulSets,
+// DaemonSets, CronJobs and unstructured objects (see PodTemplatePath) are supported. Jobs
+// are left unchanged, as the pod template of a Job cannot be updated once it is created.
 func (trigger RolloutTrigger) Add(params ...string) resource.TemplateMutationFunction {
 	var domain string
 	if len(params) == 0 {
@@ -41,53 +50,158 @@ func (trigger RolloutTrigger) Add(params ...string) resource.TemplateMutationFun
 		domain = params[0]
 	}
 	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		if _, ok := desired.(*batchv1.Job); ok {
+			return nil
+		}
 
-		hash, err := trigger.GetHash(ctx, cl, desired.GetNamespace())
+		content, legacy, found, err := trigger.getContent(ctx, cl, desired.GetNamespace())
 		if err != nil {
 			return err
 		}
-		trigger := map[string]string{trigger.GetAnnotationKey(domain): hash}
+		key := trigger.GetAnnotationKey(domain)
+		hash := ""
+		if found {
+			hash, err = util.HashWith(config.GetHashAlgorithm(), content)
+			if err != nil {
+				return err
+			}
+			// keep the hash computed with the legacy algorithm if the content has not
+			// changed, so changing the hash algorithm does not trigger a rollout
+			if config.GetHashAlgorithm() != util.HashAlgorithmLegacy {
+				live, err := livePodTemplateAnnotation(ctx, cl, desired, trigger.PodTemplatePath, key)
+				if err != nil {
+					return err
+				}
+				if live != "" && live == util.Hash(legacy) {
+					hash = live
+				}
+			}
+		}
+		return setPodTemplateAnnotations(desired, trigger.PodTemplatePath, map[string]string{key: hash})
+	}
+}
+
+// RolloutTriggerDiscovery inspects the pod template of a workload (see RolloutTrigger.Add) and adds
+// a RolloutTrigger for each of the Secrets and ConfigMaps referenced by it, so there is no
+// need to declare each RolloutTrigger by hand. Volumes, projected volumes, envFrom and env valueFrom
+// references are discovered (see util.PodSpecReferences). The name of the Secret or ConfigMap
+// is used as the name of the trigger, so the annotation keys are the same as the ones of an
+// equivalent RolloutTrigger (see RolloutTrigger.GetAnnotationKey).
+// Example usage:
+//
+//	&resource.Template[*appsv1.Deployment]{
+//		TemplateBuilder: deployment(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.RolloutTriggerDiscovery{ExcludeSecrets: []string{"tls"}}.Add(),
+//		},
+//	},
+type RolloutTriggerDiscovery struct {
+	// ExcludeSecrets is a list of Secret names that won't trigger rollouts
+	ExcludeSecrets []string
+	// ExcludeConfigMaps is a list of ConfigMap names that won't trigger rollouts
+	ExcludeConfigMaps []string
+	// PodTemplatePath is the JSONPath of the pod template in unstructured
+	// objects (see RolloutTrigger.PodTemplatePath)
+	PodTemplatePath string
+}
 
-		switch o := desired.(type) {
-		case *appsv1.Deployment:
-			o.Spec.Template.ObjectMeta.Annotations = util.MergeMaps(map[string]string{}, o.Spec.Template.ObjectMeta.Annotations, trigger)
-		case *appsv1.StatefulSet:
-			o.Spec.Template.ObjectMeta.Annotations = util.MergeMaps(map[string]string{}, o.Spec.Template.ObjectMeta.Annotations, trigger)
+// Add adds a trigger to the workload for each discovered Secret and ConfigMap
+func (d RolloutTriggerDiscovery) Add(params ...string) resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		spec, err := getPodSpec(desired, d.PodTemplatePath)
+		if err != nil || spec == nil {
+			return err
 		}
 
+		secrets, configMaps := util.PodSpecReferences(spec)
+		for _, name := range secrets {
+			if util.ContainsBy(d.ExcludeSecrets, func(s string) bool { return s == name }) {
+				continue
+			}
+			if err := (RolloutTrigger{Name: name, SecretName: util.Pointer(name), PodTemplatePath: d.PodTemplatePath}).Add(params...)(ctx, cl, desired); err != nil {
+				return err
+			}
+		}
+		for _, name := range configMaps {
+			if util.ContainsBy(d.ExcludeConfigMaps, func(s string) bool { return s == name }) {
+				continue
+			}
+			if err := (RolloutTrigger{Name: name, ConfigMapName: util.Pointer(name), PodTemplatePath: d.PodTemplatePath}).Add(params...)(ctx, cl, desired); err != nil {
+				return err
+			}
+		}
 		return nil
 	}
 }
 
 // GetHash returns the hash of the data contained in the RolloutTrigger
-// config source
+// config source. The hash is computed with the globally configured hash
+// algorithm (see config.SetHashAlgorithm). Note that with the default algorithm
+// the returned hash is tagged with the algorithm ("sha256.v1:<hex digest>"), unlike
+// the untagged hashes returned by previous versions. Set the algorithm to
+// util.HashAlgorithmLegacy to get hashes in the previous format.
 func (rt RolloutTrigger) GetHash(ctx context.Context, cl client.Client, namespace string) (string, error) {
+	content, _, found, err := rt.getContent(ctx, cl, namespace)
+	if err != nil || !found {
+		return "", err
+	}
+	return util.HashWith(config.GetHashAlgorithm(), content)
+}
+
+// getContent returns the data of the config source that is hashed and the data that the legacy
+// hash algorithm used to hash, which ignores the binary data of ConfigMaps. The third return
+// value is false if the config source does not exist.
+func (rt RolloutTrigger) getContent(ctx context.Context, cl client.Client, namespace string) (any, any, bool, error) {
 
 	if rt.SecretName != nil {
 		secret := &corev1.Secret{}
 		key := types.NamespacedName{Name: *rt.SecretName, Namespace: namespace}
 		if err := cl.Get(ctx, key, secret); err != nil {
 			if errors.IsNotFound(err) {
-				return "", nil
+				return nil, nil, false, nil
 			}
-			return "", err
+			return nil, nil, false, err
 		}
-		return util.Hash(secret.Data), nil
+		data := filterKeys(secret.Data, rt.Keys)
+		return data, data, true, nil
 
 	} else if rt.ConfigMapName != nil {
 		cm := &corev1.ConfigMap{}
 		key := types.NamespacedName{Name: *rt.ConfigMapName, Namespace: namespace}
 		if err := cl.Get(ctx, key, cm); err != nil {
 			if errors.IsNotFound(err) {
-				return "", nil
+				return nil, nil, false, nil
 			}
-			return "", err
+			return nil, nil, false, err
 		}
-		return util.Hash(cm.Data), nil
+		data := filterKeys(cm.Data, rt.Keys)
+		binaryData := filterKeys(cm.BinaryData, rt.Keys)
+		if len(binaryData) == 0 {
+			// keep the hash of configmaps without binary
+			// data unchanged to avoid unnecessary rollouts
+			return data, data, true, nil
+		}
+		return map[string]any{"data": data, "binaryData": binaryData}, data, true, nil
 
 	} else {
-		return "", fmt.Errorf("empty rollout trigger")
+		return nil, nil, false, fmt.Errorf("empty rollout trigger")
+	}
+}
+
+// filterKeys returns the subset of data with the given keys, or
+// the whole data if no keys are passed
+func filterKeys[T any](data map[string]T, keys []string) map[string]T {
+	if len(keys) == 0 {
+		return data
+	}
+	filtered := map[string]T{}
+	for _, key := range keys {
+		if value, ok := data[key]; ok {
+			filtered[key] = value
+		}
 	}
+	return filtered
 }
 
 // GetAnnotationKey returns the annotation key to be used in the Pods that read
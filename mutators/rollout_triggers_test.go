@@ -7,8 +7,10 @@ import (
 	"github.com/3scale-ops/basereconciler/util"
 	"github.com/google/go-cmp/cmp"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 )
@@ -18,6 +20,7 @@ func TestRolloutTrigger_GetHash(t *testing.T) {
 		Name          string
 		ConfigMapName *string
 		SecretName    *string
+		Keys          []string
 	}
 	type args struct {
 		ctx       context.Context
@@ -46,7 +49,7 @@ func TestRolloutTrigger_GetHash(t *testing.T) {
 				).Build(),
 				namespace: "ns",
 			},
-			want:    util.Hash(map[string][]byte{"key": []byte("data")}),
+			want:    hash(map[string][]byte{"key": []byte("data")}),
 			wantErr: false,
 		},
 		{
@@ -64,7 +67,48 @@ func TestRolloutTrigger_GetHash(t *testing.T) {
 				).Build(),
 				namespace: "ns",
 			},
-			want:    util.Hash(map[string]string{"key": "data"}),
+			want:    hash(map[string]string{"key": "data"}),
+			wantErr: false,
+		},
+		{
+			name: "Secret hash of a subset of keys",
+			fields: fields{
+				Name:       "secret",
+				SecretName: util.Pointer("secret"),
+				Keys:       []string{"key", "missing"},
+			},
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"},
+						Data: map[string][]byte{"key": []byte("data"), "other": []byte("other")},
+					},
+				).Build(),
+				namespace: "ns",
+			},
+			want:    hash(map[string][]byte{"key": []byte("data")}),
+			wantErr: false,
+		},
+		{
+			name: "ConfigMap hash with binary data",
+			fields: fields{
+				Name:          "cm",
+				ConfigMapName: util.Pointer("cm"),
+			},
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data:       map[string]string{"key": "data"},
+						BinaryData: map[string][]byte{"bin": []byte("data")},
+					},
+				).Build(),
+				namespace: "ns",
+			},
+			want: hash(map[string]any{
+				"data":       map[string]string{"key": "data"},
+				"binaryData": map[string][]byte{"bin": []byte("data")},
+			}),
 			wantErr: false,
 		},
 		{
@@ -102,6 +146,7 @@ func TestRolloutTrigger_GetHash(t *testing.T) {
 				Name:          tt.fields.Name,
 				ConfigMapName: tt.fields.ConfigMapName,
 				SecretName:    tt.fields.SecretName,
+				Keys:          tt.fields.Keys,
 			}
 			got, err := rt.GetHash(tt.args.ctx, tt.args.cl, tt.args.namespace)
 			if (err != nil) != tt.wantErr {
@@ -158,9 +203,10 @@ func TestRolloutTrigger_GetAnnotationKey(t *testing.T) {
 
 func TestRolloutTrigger_Add(t *testing.T) {
 	type fields struct {
-		Name          string
-		ConfigMapName *string
-		SecretName    *string
+		Name            string
+		ConfigMapName   *string
+		SecretName      *string
+		PodTemplatePath string
 	}
 	type args struct {
 		domain  string
@@ -193,7 +239,7 @@ func TestRolloutTrigger_Add(t *testing.T) {
 			want: &appsv1.Deployment{
 				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
 				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
-					Annotations: map[string]string{"example.com/cm.configmap-hash": util.Hash(map[string]string{"key": "data"})},
+					Annotations: map[string]string{"example.com/cm.configmap-hash": hash(map[string]string{"key": "data"})},
 				}}},
 			},
 			wantErr: false,
@@ -222,7 +268,7 @@ func TestRolloutTrigger_Add(t *testing.T) {
 			want: &appsv1.Deployment{
 				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
 				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
-					Annotations: map[string]string{"example.com/cm.configmap-hash": util.Hash(map[string]string{"key": "data"}), "key": "label"},
+					Annotations: map[string]string{"example.com/cm.configmap-hash": hash(map[string]string{"key": "data"}), "key": "label"},
 				}}},
 			},
 			wantErr: false,
@@ -245,18 +291,225 @@ func TestRolloutTrigger_Add(t *testing.T) {
 			want: &appsv1.StatefulSet{
 				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
 				Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"example.com/cm.configmap-hash": hash(map[string]string{"key": "data"})},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Keeps the legacy hash if the content has not changed",
+			fields: fields{
+				Name:          "cm",
+				ConfigMapName: util.Pointer("cm"),
+			},
+			args: args{
+				domain: "example.com",
+				ctx:    context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data: map[string]string{"key": "data"}},
+					&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{"example.com/cm.configmap-hash": util.Hash(map[string]string{"key": "data"})},
+						}}}},
+				).Build(),
+				desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			},
+			want: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
 					Annotations: map[string]string{"example.com/cm.configmap-hash": util.Hash(map[string]string{"key": "data"})},
 				}}},
 			},
 			wantErr: false,
 		},
+		{
+			name: "Keeps the legacy hash of configmaps with binary data if the content has not changed",
+			fields: fields{
+				Name:          "cm",
+				ConfigMapName: util.Pointer("cm"),
+			},
+			args: args{
+				domain: "example.com",
+				ctx:    context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data: map[string]string{"key": "data"}, BinaryData: map[string][]byte{"bin": []byte("data")}},
+					&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{"example.com/cm.configmap-hash": util.Hash(map[string]string{"key": "data"})},
+						}}}},
+				).Build(),
+				desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			},
+			want: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"example.com/cm.configmap-hash": util.Hash(map[string]string{"key": "data"})},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Replaces the legacy hash if the content has changed",
+			fields: fields{
+				Name:          "cm",
+				ConfigMapName: util.Pointer("cm"),
+			},
+			args: args{
+				domain: "example.com",
+				ctx:    context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data: map[string]string{"key": "new-data"}},
+					&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+							Annotations: map[string]string{"example.com/cm.configmap-hash": util.Hash(map[string]string{"key": "data"})},
+						}}}},
+				).Build(),
+				desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			},
+			want: &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"example.com/cm.configmap-hash": hash(map[string]string{"key": "new-data"})},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Adds rollout annotation to DaemonSet's pods",
+			fields: fields{
+				Name:          "cm",
+				ConfigMapName: util.Pointer("cm"),
+			},
+			args: args{
+				domain: "example.com",
+				ctx:    context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data: map[string]string{"key": "data"}},
+				).Build(),
+				desired: &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			},
+			want: &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+				Spec: appsv1.DaemonSetSpec{Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{"example.com/cm.configmap-hash": hash(map[string]string{"key": "data"})},
+				}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Adds rollout annotation to CronJob's pods",
+			fields: fields{
+				Name:          "cm",
+				ConfigMapName: util.Pointer("cm"),
+			},
+			args: args{
+				domain: "example.com",
+				ctx:    context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data: map[string]string{"key": "data"}},
+				).Build(),
+				desired: &batchv1.CronJob{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			},
+			want: &batchv1.CronJob{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+				Spec: batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{
+					Template: corev1.PodTemplateSpec{ObjectMeta: metav1.ObjectMeta{
+						Annotations: map[string]string{"example.com/cm.configmap-hash": hash(map[string]string{"key": "data"})},
+					}}}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Does not add rollout annotation to Jobs",
+			fields: fields{
+				Name:          "cm",
+				ConfigMapName: util.Pointer("cm"),
+			},
+			args: args{
+				domain: "example.com",
+				ctx:    context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data: map[string]string{"key": "data"}},
+				).Build(),
+				desired: &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			},
+			want:    &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			wantErr: false,
+		},
+		{
+			name: "Adds rollout annotation to unstructured objects",
+			fields: fields{
+				Name:            "cm",
+				ConfigMapName:   util.Pointer("cm"),
+				PodTemplatePath: "spec.template",
+			},
+			args: args{
+				domain: "example.com",
+				ctx:    context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data: map[string]string{"key": "data"}},
+				).Build(),
+				desired: &unstructured.Unstructured{Object: map[string]any{
+					"apiVersion": "argoproj.io/v1alpha1",
+					"kind":       "Rollout",
+					"metadata":   map[string]any{"name": "rollout", "namespace": "ns"},
+					"spec": map[string]any{"template": map[string]any{
+						"metadata": map[string]any{"annotations": map[string]any{"key": "value"}},
+					}},
+				}},
+			},
+			want: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Rollout",
+				"metadata":   map[string]any{"name": "rollout", "namespace": "ns"},
+				"spec": map[string]any{"template": map[string]any{
+					"metadata": map[string]any{"annotations": map[string]any{
+						"key":                           "value",
+						"example.com/cm.configmap-hash": hash(map[string]string{"key": "data"}),
+					}},
+				}},
+			}},
+			wantErr: false,
+		},
+		{
+			name: "Fails if the pod template is not found",
+			fields: fields{
+				Name:            "cm",
+				ConfigMapName:   util.Pointer("cm"),
+				PodTemplatePath: "spec.podTemplate",
+			},
+			args: args{
+				domain: "example.com",
+				ctx:    context.TODO(),
+				cl:     fake.NewClientBuilder().Build(),
+				desired: &unstructured.Unstructured{Object: map[string]any{
+					"apiVersion": "argoproj.io/v1alpha1",
+					"kind":       "Rollout",
+					"metadata":   map[string]any{"name": "rollout", "namespace": "ns"},
+				}},
+			},
+			want: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Rollout",
+				"metadata":   map[string]any{"name": "rollout", "namespace": "ns"},
+			}},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			trigger := RolloutTrigger{
-				Name:          tt.fields.Name,
-				ConfigMapName: tt.fields.ConfigMapName,
-				SecretName:    tt.fields.SecretName,
+				Name:            tt.fields.Name,
+				ConfigMapName:   tt.fields.ConfigMapName,
+				SecretName:      tt.fields.SecretName,
+				PodTemplatePath: tt.fields.PodTemplatePath,
 			}
 			err := trigger.Add(tt.args.domain)(tt.args.ctx, tt.args.cl, tt.args.desired)
 			if (err != nil) != tt.wantErr {
@@ -268,3 +521,111 @@ func TestRolloutTrigger_Add(t *testing.T) {
 		})
 	}
 }
+
+func TestRolloutTriggerDiscovery_Add(t *testing.T) {
+	cl := fake.NewClientBuilder().WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+			Data: map[string]string{"key": "data"}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"},
+			Data: map[string][]byte{"key": []byte("data")}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "excluded", Namespace: "ns"},
+			Data: map[string][]byte{"key": []byte("data")}},
+	).Build()
+	podSpec := corev1.PodSpec{
+		Volumes: []corev1.Volume{
+			{Name: "secret", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "secret"}}},
+			{Name: "excluded", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "excluded"}}},
+		},
+		Containers: []corev1.Container{{
+			Name: "container",
+			EnvFrom: []corev1.EnvFromSource{
+				{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "cm"}}},
+			},
+		}},
+	}
+
+	tests := []struct {
+		name      string
+		discovery RolloutTriggerDiscovery
+		desired   client.Object
+		want      client.Object
+	}{
+		{
+			name:      "Adds rollout annotations to Deployment's pods",
+			discovery: RolloutTriggerDiscovery{ExcludeSecrets: []string{"excluded"}},
+			desired: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "deploy", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: podSpec}}},
+			want: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "deploy", Namespace: "ns"},
+				Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+						"example.com/cm.configmap-hash":  hash(map[string]string{"key": "data"}),
+						"example.com/secret.secret-hash": hash(map[string][]byte{"key": []byte("data")}),
+					}},
+					Spec: podSpec,
+				}}},
+		},
+		{
+			name:      "Adds rollout annotations to StatefulSet's pods",
+			discovery: RolloutTriggerDiscovery{ExcludeSecrets: []string{"excluded", "secret"}},
+			desired: &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "sts", Namespace: "ns"},
+				Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{Spec: podSpec}}},
+			want: &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: "sts", Namespace: "ns"},
+				Spec: appsv1.StatefulSetSpec{Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+						"example.com/cm.configmap-hash": hash(map[string]string{"key": "data"}),
+					}},
+					Spec: podSpec,
+				}}},
+		},
+		{
+			name:      "Adds rollout annotations to unstructured objects",
+			discovery: RolloutTriggerDiscovery{ExcludeSecrets: []string{"excluded", "secret"}},
+			desired: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Rollout",
+				"metadata":   map[string]any{"name": "rollout", "namespace": "ns"},
+				"spec": map[string]any{"template": map[string]any{
+					"spec": map[string]any{"containers": []any{map[string]any{
+						"name":    "container",
+						"envFrom": []any{map[string]any{"configMapRef": map[string]any{"name": "cm"}}},
+					}}},
+				}},
+			}},
+			want: &unstructured.Unstructured{Object: map[string]any{
+				"apiVersion": "argoproj.io/v1alpha1",
+				"kind":       "Rollout",
+				"metadata":   map[string]any{"name": "rollout", "namespace": "ns"},
+				"spec": map[string]any{"template": map[string]any{
+					"metadata": map[string]any{"annotations": map[string]any{
+						"example.com/cm.configmap-hash": hash(map[string]string{"key": "data"}),
+					}},
+					"spec": map[string]any{"containers": []any{map[string]any{
+						"name":    "container",
+						"envFrom": []any{map[string]any{"configMapRef": map[string]any{"name": "cm"}}},
+					}}},
+				}},
+			}},
+		},
+		{
+			name:      "Ignores other types",
+			discovery: RolloutTriggerDiscovery{},
+			desired:   &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}},
+			want:      &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.discovery.Add("example.com")(context.TODO(), cl, tt.desired); err != nil {
+				t.Errorf("RolloutTriggerDiscovery.Add() error = %v", err)
+			}
+			if diff := cmp.Diff(tt.desired, tt.want); len(diff) > 0 {
+				t.Errorf("RolloutTriggerDiscovery.Add() diff = %v", diff)
+			}
+		})
+	}
+}
+
+func hash(o any) string {
+	h, _ := util.HashWith(util.HashAlgorithmSHA256, o)
+	return h
+}
@@ -0,0 +1,105 @@
+package mutators
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// DefaultSecretGeneratorLength is the default length of the values
+	// generated by the SecretGenerator
+	DefaultSecretGeneratorLength = 32
+	// DefaultSecretGeneratorCharset is the default set of characters
+	// used in the values generated by the SecretGenerator
+	DefaultSecretGeneratorCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+// SecretGenerator generates random values for some keys of a Secret, like passwords or
+// tokens. The values are generated when the Secret is first created and the live values are
+// used afterwards, so the generated values are kept stable. The live Secret is read directly from
+// the API server when available (see resource.APIReaderFrom), so a stale cache does not cause the
+// values to be generated again. Values set in the template for the
+// generated keys are used instead of random ones, unless a live value exists. It can be combined
+// with resource.ReconcilePolicyCreateOnly so the Secret is never updated once created.
+// Example usage:
+//
+//	&resource.Template[*corev1.Secret]{
+//		TemplateBuilder: adminCredentials(),
+//		IsEnabled:       true,
+//		TemplateMutations: []resource.TemplateMutationFunction{
+//			mutators.SecretGenerator{Keys: []string{"password"}}.Add(),
+//		},
+//	},
+type SecretGenerator struct {
+	// Keys is the list of keys of the Secret data that are generated
+	Keys []string
+	// Length is the length of the generated values. Defaults to
+	// DefaultSecretGeneratorLength.
+	Length int
+	// Charset is the set of characters used in the generated values. Defaults
+	// to DefaultSecretGeneratorCharset.
+	Charset string
+}
+
+// Add generates the values of the configured keys in the Secret
+func (g SecretGenerator) Add() resource.TemplateMutationFunction {
+	return func(ctx context.Context, cl client.Client, desired client.Object) error {
+		secret := desired.(*corev1.Secret)
+		live := &corev1.Secret{}
+		// read the live Secret directly from the API server, as a stale
+		// cache would cause the values to be generated again
+		if err := resource.APIReaderFrom(ctx, cl).Get(ctx, client.ObjectKeyFromObject(desired), live); err != nil {
+			if !errors.IsNotFound(err) {
+				return fmt.Errorf("unable to retrieve live object: %w", err)
+			}
+		}
+
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		for _, key := range g.Keys {
+			if value := live.Data[key]; len(value) > 0 {
+				secret.Data[key] = value
+				delete(secret.StringData, key)
+				continue
+			}
+			if len(secret.Data[key]) > 0 || secret.StringData[key] != "" {
+				continue
+			}
+			value, err := g.generate()
+			if err != nil {
+				return fmt.Errorf("unable to generate value for key %s: %w", key, err)
+			}
+			secret.Data[key] = value
+		}
+		return nil
+	}
+}
+
+// generate returns a random value using a cryptographically secure random generator
+func (g SecretGenerator) generate() ([]byte, error) {
+	length, charset := g.Length, g.Charset
+	if length <= 0 {
+		length = DefaultSecretGeneratorLength
+	}
+	if charset == "" {
+		charset = DefaultSecretGeneratorCharset
+	}
+	max := big.NewInt(int64(len(charset)))
+	value := make([]byte, length)
+	for i := range value {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return nil, err
+		}
+		value[i] = charset[n.Int64()]
+	}
+	return value, nil
+}
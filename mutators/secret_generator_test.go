@@ -0,0 +1,104 @@
+package mutators
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSecretGenerator_Add(t *testing.T) {
+	tests := []struct {
+		name      string
+		generator SecretGenerator
+		cl        client.Client
+		reader    client.Reader
+		desired   *corev1.Secret
+		check     func(*testing.T, *corev1.Secret)
+	}{
+		{
+			name:      "Generates values when the Secret does not exist",
+			generator: SecretGenerator{Keys: []string{"password", "token"}, Length: 16, Charset: "ab"},
+			cl:        fake.NewClientBuilder().Build(),
+			desired: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"},
+				Data: map[string][]byte{"user": []byte("admin")}},
+			check: func(t *testing.T, s *corev1.Secret) {
+				for _, key := range []string{"password", "token"} {
+					if len(s.Data[key]) != 16 || strings.Trim(string(s.Data[key]), "ab") != "" {
+						t.Errorf("SecretGenerator.Add() %s = %q", key, s.Data[key])
+					}
+				}
+				if string(s.Data["user"]) != "admin" {
+					t.Errorf("SecretGenerator.Add() user = %q", s.Data["user"])
+				}
+			},
+		},
+		{
+			name:      "Keeps the live values",
+			generator: SecretGenerator{Keys: []string{"password", "token"}},
+			cl: fake.NewClientBuilder().WithObjects(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"},
+				Data:       map[string][]byte{"password": []byte("live")},
+			}).Build(),
+			desired: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"},
+				StringData: map[string]string{"password": "template"}},
+			check: func(t *testing.T, s *corev1.Secret) {
+				if string(s.Data["password"]) != "live" {
+					t.Errorf("SecretGenerator.Add() password = %q", s.Data["password"])
+				}
+				if _, ok := s.StringData["password"]; ok {
+					t.Errorf("SecretGenerator.Add() expected password to be removed from stringData")
+				}
+				if len(s.Data["token"]) != DefaultSecretGeneratorLength {
+					t.Errorf("SecretGenerator.Add() token = %q", s.Data["token"])
+				}
+			},
+		},
+		{
+			name:      "Reads the live values bypassing the cache",
+			generator: SecretGenerator{Keys: []string{"password"}},
+			// the Secret has been created but the cache has not caught up yet
+			cl: fake.NewClientBuilder().Build(),
+			reader: fake.NewClientBuilder().WithObjects(&corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"},
+				Data:       map[string][]byte{"password": []byte("live")},
+			}).Build(),
+			desired: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}},
+			check: func(t *testing.T, s *corev1.Secret) {
+				if string(s.Data["password"]) != "live" {
+					t.Errorf("SecretGenerator.Add() password = %q", s.Data["password"])
+				}
+			},
+		},
+		{
+			name:      "Uses the template values if there are no live values",
+			generator: SecretGenerator{Keys: []string{"password"}},
+			cl:        fake.NewClientBuilder().Build(),
+			desired: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"},
+				Data: map[string][]byte{"password": []byte("template")}},
+			check: func(t *testing.T, s *corev1.Secret) {
+				if string(s.Data["password"]) != "template" {
+					t.Errorf("SecretGenerator.Add() password = %q", s.Data["password"])
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			if tt.reader != nil {
+				ctx = resource.ContextWithAPIReader(ctx, tt.reader)
+			}
+			if err := tt.generator.Add()(ctx, tt.cl, tt.desired); err != nil {
+				t.Errorf("SecretGenerator.Add() error = %v", err)
+				return
+			}
+			tt.check(t, tt.desired)
+		})
+	}
+}
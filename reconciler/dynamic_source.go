@@ -0,0 +1,198 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	toolscache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// dynamicSource is the source.Source used for the dynamic watches. It works like
+// the sources returned by source.Kind but, unlike those, it can be stopped once
+// the watched type is no longer in use. Stopping the source removes its event handler
+// from the informer and, if configured to, also stops the informer once no other
+// dynamic source sharing the same users counter is using it.
+type dynamicSource struct {
+	cache          cache.Cache
+	obj            client.Object
+	handler        handler.EventHandler
+	predicates     []predicate.Predicate
+	removeInformer bool
+	// users counts the dynamic sources that use each informer. It
+	// is shared by all the dynamic sources of the Reconciler.
+	users *informerUsers
+
+	mu           sync.Mutex
+	informer     cache.Informer
+	registration toolscache.ResourceEventHandlerRegistration
+	stopped      bool
+}
+
+// Start implements source.Source
+func (s *dynamicSource) Start(ctx context.Context, q workqueue.TypedRateLimitingInterface[reconcile.Request]) error {
+	informer, err := s.cache.GetInformer(ctx, s.obj, cache.BlockUntilSynced(false))
+	if err != nil {
+		return fmt.Errorf("unable to get informer for %s: %w", s, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return nil
+	}
+	registration, err := informer.AddEventHandler(informerEventHandler{
+		ctx: ctx, handler: s.handler, predicates: s.predicates, queue: q,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add event handler for %s: %w", s, err)
+	}
+	s.informer, s.registration = informer, registration
+	s.users.acquire(s.informerKey())
+	return nil
+}
+
+// WaitForSync implements source.SyncingSource, blocking until the
+// informer used by the source has synced, as source.Kind does.
+func (s *dynamicSource) WaitForSync(ctx context.Context) error {
+	s.mu.Lock()
+	informer := s.informer
+	s.mu.Unlock()
+	if informer == nil {
+		return nil
+	}
+	if !toolscache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("timed out waiting for the cache of %s to sync: %w", s, ctx.Err())
+	}
+	return nil
+}
+
+// stop removes the event handler from the informer and stops the informer if
+// required and no other source uses it. A stopped source cannot be restarted.
+func (s *dynamicSource) stop(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stopped = true
+	if s.informer == nil {
+		return nil
+	}
+	if err := s.informer.RemoveEventHandler(s.registration); err != nil {
+		return err
+	}
+	s.informer = nil
+	if last := s.users.release(s.informerKey()); !s.removeInformer || !last {
+		return nil
+	}
+	return s.cache.RemoveInformer(ctx, s.obj)
+}
+
+// informerKey identifies the informer used by the source. The cache keeps
+// separate informers for typed, unstructured and metadata only objects.
+func (s *dynamicSource) informerKey() string {
+	return fmt.Sprintf("%T %s", s.obj, s.obj.GetObjectKind().GroupVersionKind())
+}
+
+func (s *dynamicSource) String() string {
+	return fmt.Sprintf("dynamic source: %T", s.obj)
+}
+
+// informerUsers counts the dynamic sources that use each informer, so the
+// informer is only stopped when the last of them stops. The zero value is
+// ready to use and a nil *informerUsers does not count anything.
+type informerUsers struct {
+	mu    sync.Mutex
+	count map[string]int
+}
+
+func (u *informerUsers) acquire(key string) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.count == nil {
+		u.count = map[string]int{}
+	}
+	u.count[key]++
+}
+
+// release returns true if there are no other users of the informer
+func (u *informerUsers) release(key string) bool {
+	if u == nil {
+		return true
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.count[key]--; u.count[key] > 0 {
+		return false
+	}
+	delete(u.count, key)
+	return true
+}
+
+// informerEventHandler adapts a handler.EventHandler to the
+// event handler interface of the client-go informers
+type informerEventHandler struct {
+	ctx        context.Context
+	handler    handler.EventHandler
+	predicates []predicate.Predicate
+	queue      workqueue.TypedRateLimitingInterface[reconcile.Request]
+}
+
+func (h informerEventHandler) OnAdd(obj interface{}, isInInitialList bool) {
+	o, ok := obj.(client.Object)
+	if !ok {
+		return
+	}
+	e := event.CreateEvent{Object: o}
+	for _, p := range h.predicates {
+		if !p.Create(e) {
+			return
+		}
+	}
+	h.handler.Create(h.ctx, e, h.queue)
+}
+
+func (h informerEventHandler) OnUpdate(oldObj, newObj interface{}) {
+	oldO, ok := oldObj.(client.Object)
+	if !ok {
+		return
+	}
+	newO, ok := newObj.(client.Object)
+	if !ok {
+		return
+	}
+	e := event.UpdateEvent{ObjectOld: oldO, ObjectNew: newO}
+	for _, p := range h.predicates {
+		if !p.Update(e) {
+			return
+		}
+	}
+	h.handler.Update(h.ctx, e, h.queue)
+}
+
+func (h informerEventHandler) OnDelete(obj interface{}) {
+	e := event.DeleteEvent{}
+	if tombstone, ok := obj.(toolscache.DeletedFinalStateUnknown); ok {
+		e.DeleteStateUnknown = true
+		obj = tombstone.Obj
+	}
+	o, ok := obj.(client.Object)
+	if !ok {
+		return
+	}
+	e.Object = o
+	for _, p := range h.predicates {
+		if !p.Delete(e) {
+			return
+		}
+	}
+	h.handler.Delete(h.ctx, e, h.queue)
+}
@@ -0,0 +1,127 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/cache/informertest"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func Test_dynamicSource(t *testing.T) {
+	tests := []struct {
+		name           string
+		removeInformer bool
+		wantInformer   bool
+	}{
+		{
+			name:           "Keeps the informer",
+			removeInformer: false,
+			wantInformer:   true,
+		},
+		{
+			name:           "Stops the informer",
+			removeInformer: true,
+			wantInformer:   false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.TODO()
+			informers := &informertest.FakeInformers{}
+			q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+			defer q.ShutDown()
+
+			src := &dynamicSource{
+				cache:          informers,
+				obj:            &corev1.ConfigMap{},
+				handler:        &handler.EnqueueRequestForObject{},
+				predicates:     []predicate.Predicate{predicate.GenerationChangedPredicate{}},
+				removeInformer: tt.removeInformer,
+			}
+			if err := src.Start(ctx, q); err != nil {
+				t.Fatalf("dynamicSource.Start() error = %v", err)
+			}
+
+			informer, _ := informers.FakeInformerFor(ctx, &corev1.ConfigMap{})
+			informer.Synced = true
+			if err := src.WaitForSync(ctx); err != nil {
+				t.Fatalf("dynamicSource.WaitForSync() error = %v", err)
+			}
+			cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns", Generation: 1}}
+			informer.Add(cm)
+			// filtered out by the predicate
+			informer.Update(cm, cm)
+			if q.Len() != 1 {
+				t.Errorf("dynamicSource got %d requests, want 1", q.Len())
+			}
+
+			if err := src.stop(ctx); err != nil {
+				t.Fatalf("dynamicSource.stop() error = %v", err)
+			}
+			if _, ok := informers.InformersByGVK[corev1.SchemeGroupVersion.WithKind("ConfigMap")]; ok != tt.wantInformer {
+				t.Errorf("dynamicSource.stop() informer present = %v, want %v", ok, tt.wantInformer)
+			}
+		})
+	}
+}
+
+func Test_dynamicSource_WaitForSync(t *testing.T) {
+	// the fake informers never sync unless told to
+	informers := &informertest.FakeInformers{}
+	q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer q.ShutDown()
+
+	src := &dynamicSource{cache: informers, obj: &corev1.ConfigMap{}, handler: &handler.EnqueueRequestForObject{}}
+	if err := src.Start(context.TODO(), q); err != nil {
+		t.Fatalf("dynamicSource.Start() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	if err := src.WaitForSync(ctx); err == nil {
+		t.Errorf("dynamicSource.WaitForSync() expected an error for an informer that never syncs")
+	}
+}
+
+func Test_dynamicSource_sharedInformer(t *testing.T) {
+	ctx := context.TODO()
+	informers := &informertest.FakeInformers{}
+	users := &informerUsers{}
+	q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer q.ShutDown()
+	gvk := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+
+	// an owned and a referenced watch of the same type
+	owned := &dynamicSource{cache: informers, obj: &corev1.ConfigMap{}, handler: &handler.EnqueueRequestForObject{}, removeInformer: true, users: users}
+	referenced := &dynamicSource{cache: informers, obj: &corev1.ConfigMap{}, handler: &handler.EnqueueRequestForObject{}, removeInformer: true, users: users}
+	for _, src := range []*dynamicSource{owned, referenced} {
+		if err := src.Start(ctx, q); err != nil {
+			t.Fatalf("dynamicSource.Start() error = %v", err)
+		}
+	}
+
+	if err := owned.stop(ctx); err != nil {
+		t.Fatalf("dynamicSource.stop() error = %v", err)
+	}
+	if _, ok := informers.InformersByGVK[gvk]; !ok {
+		t.Errorf("dynamicSource.stop() removed the informer still in use by other watches")
+	}
+	informer, _ := informers.FakeInformerFor(ctx, &corev1.ConfigMap{})
+	informer.Add(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}})
+	if q.Len() != 1 {
+		t.Errorf("dynamicSource got %d requests, want 1", q.Len())
+	}
+
+	if err := referenced.stop(ctx); err != nil {
+		t.Fatalf("dynamicSource.stop() error = %v", err)
+	}
+	if _, ok := informers.InformersByGVK[gvk]; ok {
+		t.Errorf("dynamicSource.stop() expected the informer to be removed by its last user")
+	}
+}
@@ -0,0 +1,159 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// FinalizationProgressAnnotationKey returns the annotation that holds the comma separated
+// list of the finalization steps that have already been completed (see WithFinalizationStep)
+func FinalizationProgressAnnotationKey() string {
+	return fmt.Sprintf("%s/finalization-completed", config.GetAnnotationsDomain())
+}
+
+// FinalizationStepFunction is a finalization step. It receives the custom resource being deleted. A step
+// that has not finished yet can return a resource.DelayError (see resource.Delay) to requeue the custom
+// resource after the given time, while any other error is returned as a reconcile error.
+type FinalizationStepFunction func(ctx context.Context, cl client.Client, obj client.Object) error
+
+type finalizationStep struct {
+	name string
+	fn   FinalizationStepFunction
+}
+
+func (s finalizationStep) applyToLifecycleOptions(opts *lifecycleOptions) {
+	// the names are stored comma separated in the
+	// progress annotation, so they need to be validated
+	switch {
+	case s.name == "" || strings.Contains(s.name, ","):
+		opts.errors = append(opts.errors, fmt.Errorf("invalid finalization step name %q: names must be non empty and not contain commas", s.name))
+	case util.ContainsBy(opts.finalizationLogic, func(x finalizationStep) bool { return x.name == s.name }):
+		opts.errors = append(opts.errors, fmt.Errorf("duplicate finalization step name %q", s.name))
+	default:
+		opts.finalizationLogic = append(opts.finalizationLogic, s)
+	}
+}
+
+// WithFinalizationStep can be used to provide named steps that will be run on object finalization. Steps and
+// the functions passed with WithFinalizationFunc run in the order they are passed. Once a step completes, its
+// name is recorded in the custom resource (see FinalizationProgressAnnotationKey) so it is not run again in the
+// following reconciles. Names must be unique, non empty and cannot contain commas, otherwise
+// ManageResourceLifecycle returns an error. A Finalizer must be set for the steps to be called.
+// Example usage:
+//
+//	reconciler.WithFinalizationStep("backup", func(ctx context.Context, cl client.Client, o client.Object) error {
+//		done, err := backup(ctx, o)
+//		if err != nil {
+//			return err
+//		}
+//		if !done {
+//			return resource.Delay(30*time.Second, "backup in progress")
+//		}
+//		return nil
+//	}),
+func WithFinalizationStep(name string, fn FinalizationStepFunction) finalizationStep {
+	return finalizationStep{name: name, fn: fn}
+}
+
+// FinalizationDeadlinePolicy defines what happens when the finalization of
+// a custom resource has not completed before the deadline
+type FinalizationDeadlinePolicy string
+
+const (
+	// FinalizationDeadlineGiveUp stops running the finalization logic and removes the
+	// finalizer, so the custom resource is deleted. A warning event is published.
+	FinalizationDeadlineGiveUp FinalizationDeadlinePolicy = "GiveUp"
+	// FinalizationDeadlineEscalate keeps running the finalization logic, publishing a warning
+	// event in every attempt so the problem is surfaced to the users.
+	FinalizationDeadlineEscalate FinalizationDeadlinePolicy = "Escalate"
+)
+
+type finalizationDeadline struct {
+	after  time.Duration
+	policy FinalizationDeadlinePolicy
+}
+
+func (d finalizationDeadline) applyToLifecycleOptions(opts *lifecycleOptions) {
+	opts.finalizationDeadline = &d
+}
+
+// WithFinalizationDeadline sets the time, since the deletion of the custom resource was requested,
+// that the finalization logic has to complete. The policy defines what happens once the deadline
+// is exceeded and the finalization logic still fails or is in progress.
+func WithFinalizationDeadline(after time.Duration, policy FinalizationDeadlinePolicy) finalizationDeadline {
+	return finalizationDeadline{after: after, policy: policy}
+}
+
+// finalize runs the finalization logic. It returns true when the finalization has completed
+// and the finalizer can be removed, otherwise the returned Result needs to be returned.
+func (r *Reconciler) finalize(ctx context.Context, obj client.Object, steps []finalizationStep,
+	deadline *finalizationDeadline) (Result, bool) {
+
+	logger := logr.FromContextOrDiscard(ctx)
+	expired := deadline != nil && obj.GetDeletionTimestamp() != nil &&
+		time.Since(obj.GetDeletionTimestamp().Time) > deadline.after
+
+	for _, step := range steps {
+		if step.name != "" && isFinalizationStepCompleted(obj, step.name) {
+			continue
+		}
+
+		if err := step.fn(ctx, r.Client, obj); err != nil {
+			if expired {
+				if deadline.policy == FinalizationDeadlineGiveUp {
+					logger.Error(err, "finalization deadline exceeded, giving up", "step", step.name)
+					r.recordEvent(obj, "FinalizationAbandoned",
+						"finalization did not complete within %s, giving up: %v", deadline.after, err)
+					return Result{}, true
+				}
+				r.recordEvent(obj, "FinalizationDeadlineExceeded",
+					"finalization did not complete within %s: %v", deadline.after, err)
+			}
+			if result, ok := delayedResult(ctx, err); ok {
+				return result, false
+			}
+			return Result{Error: err}, false
+		}
+
+		if step.name != "" {
+			completed := strings.Join(append(completedFinalizationSteps(obj), step.name), ",")
+			obj.SetAnnotations(util.MergeMaps(map[string]string{}, obj.GetAnnotations(),
+				map[string]string{FinalizationProgressAnnotationKey(): completed}))
+			if err := r.Client.Update(ctx, obj); err != nil {
+				return Result{Error: fmt.Errorf("unable to record finalization progress: %w", err)}, false
+			}
+			logger.V(1).Info("finalization step completed", "step", step.name)
+		}
+	}
+	return Result{}, true
+}
+
+// completedFinalizationSteps returns the names of the finalization
+// steps already completed
+func completedFinalizationSteps(obj client.Object) []string {
+	value := obj.GetAnnotations()[FinalizationProgressAnnotationKey()]
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func isFinalizationStepCompleted(obj client.Object, name string) bool {
+	return util.ContainsBy(completedFinalizationSteps(obj), func(s string) bool { return s == name })
+}
+
+// recordEvent publishes a warning event on the object, if the
+// Reconciler has an event recorder
+func (r *Reconciler) recordEvent(obj client.Object, reason, messageFmt string, args ...any) {
+	if r.recorder != nil {
+		r.recorder.Eventf(obj, corev1.EventTypeWarning, reason, messageFmt, args...)
+	}
+}
@@ -0,0 +1,180 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconciler_finalize(t *testing.T) {
+	step := func(calls *[]string, name string, err error) finalizationStep {
+		return WithFinalizationStep(name, func(_ context.Context, _ client.Client, o client.Object) error {
+			*calls = append(*calls, fmt.Sprintf("%s/%s", o.GetName(), name))
+			return err
+		})
+	}
+	tests := []struct {
+		name            string
+		deletedSince    time.Duration
+		annotations     map[string]string
+		steps           func(*[]string) []finalizationStep
+		deadline        *finalizationDeadline
+		want            Result
+		wantDone        bool
+		wantCalls       []string
+		wantAnnotations map[string]string
+		wantEvents      int
+	}{
+		{
+			name: "Runs all the steps",
+			steps: func(calls *[]string) []finalizationStep {
+				return []finalizationStep{step(calls, "a", nil), step(calls, "b", nil)}
+			},
+			want:            Result{},
+			wantDone:        true,
+			wantCalls:       []string{"obj/a", "obj/b"},
+			wantAnnotations: map[string]string{FinalizationProgressAnnotationKey(): "a,b"},
+		},
+		{
+			name:        "Skips completed steps",
+			annotations: map[string]string{FinalizationProgressAnnotationKey(): "a"},
+			steps: func(calls *[]string) []finalizationStep {
+				return []finalizationStep{step(calls, "a", nil), step(calls, "b", nil)}
+			},
+			want:            Result{},
+			wantDone:        true,
+			wantCalls:       []string{"obj/b"},
+			wantAnnotations: map[string]string{FinalizationProgressAnnotationKey(): "a,b"},
+		},
+		{
+			name: "Requeues steps in progress",
+			steps: func(calls *[]string) []finalizationStep {
+				return []finalizationStep{step(calls, "a", nil), step(calls, "b", resource.Delay(time.Minute, "in progress")),
+					step(calls, "c", nil)}
+			},
+			want:            Result{Action: ReturnAction, RequeueAfter: time.Minute},
+			wantDone:        false,
+			wantCalls:       []string{"obj/a", "obj/b"},
+			wantAnnotations: map[string]string{FinalizationProgressAnnotationKey(): "a"},
+		},
+		{
+			name:         "Gives up after the deadline",
+			deletedSince: time.Hour,
+			steps: func(calls *[]string) []finalizationStep {
+				return []finalizationStep{step(calls, "a", fmt.Errorf("error")), step(calls, "b", nil)}
+			},
+			deadline:   &finalizationDeadline{after: time.Minute, policy: FinalizationDeadlineGiveUp},
+			want:       Result{},
+			wantDone:   true,
+			wantCalls:  []string{"obj/a"},
+			wantEvents: 1,
+		},
+		{
+			name:         "Escalates after the deadline",
+			deletedSince: time.Hour,
+			steps: func(calls *[]string) []finalizationStep {
+				return []finalizationStep{step(calls, "a", resource.Delay(time.Minute, "in progress"))}
+			},
+			deadline:   &finalizationDeadline{after: time.Minute, policy: FinalizationDeadlineEscalate},
+			want:       Result{Action: ReturnAction, RequeueAfter: time.Minute},
+			wantDone:   false,
+			wantCalls:  []string{"obj/a"},
+			wantEvents: 1,
+		},
+		{
+			name:         "Does not escalate before the deadline",
+			deletedSince: time.Second,
+			steps: func(calls *[]string) []finalizationStep {
+				return []finalizationStep{step(calls, "a", resource.Delay(time.Minute, "in progress"))}
+			},
+			deadline:  &finalizationDeadline{after: time.Minute, policy: FinalizationDeadlineGiveUp},
+			want:      Result{Action: ReturnAction, RequeueAfter: time.Minute},
+			wantDone:  false,
+			wantCalls: []string{"obj/a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "obj", Namespace: "ns", Annotations: tt.annotations,
+				DeletionTimestamp: &metav1.Time{Time: time.Now().Add(-tt.deletedSince)}, Finalizers: []string{"finalizer"}}}
+			cl := fake.NewClientBuilder().WithObjects(obj).Build()
+			recorder := record.NewFakeRecorder(10)
+			r := &Reconciler{Client: cl, Scheme: scheme.Scheme, recorder: recorder}
+
+			calls := []string{}
+			got, done := r.finalize(context.TODO(), obj, tt.steps(&calls), tt.deadline)
+			if diff := cmp.Diff(got, tt.want); len(diff) > 0 {
+				t.Errorf("Reconciler.finalize() result diff = %v", diff)
+			}
+			if done != tt.wantDone {
+				t.Errorf("Reconciler.finalize() done = %v, want %v", done, tt.wantDone)
+			}
+			if diff := cmp.Diff(calls, tt.wantCalls); len(diff) > 0 {
+				t.Errorf("Reconciler.finalize() calls diff = %v", diff)
+			}
+			live := &corev1.ConfigMap{}
+			if err := cl.Get(context.TODO(), types.NamespacedName{Name: "obj", Namespace: "ns"}, live); err != nil {
+				t.Fatalf("unable to get object: %v", err)
+			}
+			if diff := cmp.Diff(live.GetAnnotations(), tt.wantAnnotations); len(diff) > 0 {
+				t.Errorf("Reconciler.finalize() annotations diff = %v", diff)
+			}
+			if len(recorder.Events) != tt.wantEvents {
+				t.Errorf("Reconciler.finalize() got %d events, want %d", len(recorder.Events), tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestWithFinalizationStep_validation(t *testing.T) {
+	noop := func(context.Context, client.Client, client.Object) error { return nil }
+	tests := []struct {
+		name    string
+		opts    []lifecycleOption
+		wantErr bool
+	}{
+		{
+			name:    "Accepts valid names",
+			opts:    []lifecycleOption{WithFinalizationStep("a", noop), WithFinalizationStep("b", noop), WithFinalizationFunc(func(context.Context, client.Client) error { return nil })},
+			wantErr: false,
+		},
+		{
+			name:    "Rejects empty names",
+			opts:    []lifecycleOption{WithFinalizationStep("", noop)},
+			wantErr: true,
+		},
+		{
+			name:    "Rejects names with commas",
+			opts:    []lifecycleOption{WithFinalizationStep("a,b", noop)},
+			wantErr: true,
+		},
+		{
+			name:    "Rejects duplicate names",
+			opts:    []lifecycleOption{WithFinalizationStep("a", noop), WithFinalizationStep("a", noop)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "obj", Namespace: "ns"}}
+			r := &Reconciler{Client: fake.NewClientBuilder().WithObjects(obj).Build(), Scheme: scheme.Scheme}
+			got := r.ManageResourceLifecycle(context.TODO(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "obj", Namespace: "ns"}},
+				&corev1.ConfigMap{}, tt.opts...)
+			if (got.Error != nil) != tt.wantErr {
+				t.Errorf("Reconciler.ManageResourceLifecycle() error = %v, wantErr %v", got.Error, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/3scale-ops/basereconciler/util"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// GlobalMutationFunction is a mutation that is applied to the objects built from all the
+// templates passed to ReconcileOwnedResources (see Reconciler.WithGlobalMutation). It receives
+// the owner custom resource and the desired object built by the template.
+type GlobalMutationFunction func(ctx context.Context, cl client.Client, owner client.Object, desired client.Object) error
+
+type globalMutation struct {
+	fn   GlobalMutationFunction
+	gvks []schema.GroupVersionKind
+}
+
+// WithGlobalMutation adds a mutation that ReconcileOwnedResources applies to every object built from the
+// templates, after the template's own TemplateMutations. If GVKs are passed, the mutation is only applied to
+// objects of those types. Global mutations are applied in the same order they are added. This allows to
+// implement policies that cover all the resources owned by a custom resource, like adding common labels or
+// image pull secrets, without repeating the mutation in each template.
+// It must be called before the controller is started.
+// Example usage:
+//
+//	reconciler.NewFromManager(mgr).
+//		WithGlobalMutation(func(ctx context.Context, cl client.Client, owner, desired client.Object) error {
+//			desired.SetLabels(util.MergeMaps(map[string]string{}, desired.GetLabels(),
+//				map[string]string{"app.kubernetes.io/managed-by": "my-operator"}))
+//			return nil
+//		})
+func (r *Reconciler) WithGlobalMutation(fn GlobalMutationFunction, gvks ...schema.GroupVersionKind) *Reconciler {
+	r.globalMutations = append(r.globalMutations, globalMutation{fn: fn, gvks: gvks})
+	return r
+}
+
+// globalTemplateMutations returns the global mutations as template
+// mutation functions bound to the given owner
+func (r *Reconciler) globalTemplateMutations(owner client.Object) []resource.TemplateMutationFunction {
+	mutations := make([]resource.TemplateMutationFunction, 0, len(r.globalMutations))
+	for _, gm := range r.globalMutations {
+		gm := gm
+		mutations = append(mutations, func(ctx context.Context, cl client.Client, desired client.Object) error {
+			if len(gm.gvks) > 0 {
+				gvk, err := apiutil.GVKForObject(desired, r.Scheme)
+				if err != nil {
+					return fmt.Errorf("unable to get GVK for object: %w", err)
+				}
+				if !util.ContainsBy(gm.gvks, func(x schema.GroupVersionKind) bool { return x == gvk }) {
+					return nil
+				}
+			}
+			return gm.fn(ctx, cl, owner, desired)
+		})
+	}
+	return mutations
+}
@@ -0,0 +1,71 @@
+package reconciler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/3scale-ops/basereconciler/util"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReconciler_WithGlobalMutation(t *testing.T) {
+	mgr, _ := ctrl.NewManager(&rest.Config{}, ctrl.Options{})
+	cl := fake.NewClientBuilder().Build()
+	r := (&Reconciler{Client: cl, Scheme: scheme.Scheme, mgr: mgr}).
+		WithGlobalMutation(func(ctx context.Context, cl client.Client, owner, desired client.Object) error {
+			desired.SetLabels(util.MergeMaps(map[string]string{}, desired.GetLabels(),
+				map[string]string{"app.kubernetes.io/managed-by": owner.GetName()}))
+			return nil
+		}).
+		WithGlobalMutation(func(ctx context.Context, cl client.Client, owner, desired client.Object) error {
+			desired.SetAnnotations(map[string]string{"key": "value"})
+			return nil
+		}, schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+	r.BuildTypeTracker(&testController{})
+
+	got := r.ReconcileOwnedResources(context.TODO(),
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+		[]resource.TemplateInterface{
+			resource.NewTemplateFromObjectFunction[*corev1.Service](
+				func() *corev1.Service {
+					return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns",
+						Labels: map[string]string{"app": "test"}}}
+				}),
+			resource.NewTemplateFromObjectFunction[*corev1.ConfigMap](
+				func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+				}),
+		})
+	if got.Error != nil {
+		t.Fatalf("Reconciler.ReconcileOwnedResources() error = %v", got.Error)
+	}
+
+	svc := &corev1.Service{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "service", Namespace: "ns"}, svc); err != nil {
+		t.Fatalf("unable to get service: %v", err)
+	}
+	if want := map[string]string{"app": "test", "app.kubernetes.io/managed-by": "owner"}; !reflect.DeepEqual(svc.GetLabels(), want) {
+		t.Errorf("Service labels = %v, want %v", svc.GetLabels(), want)
+	}
+	if _, ok := svc.GetAnnotations()["key"]; ok {
+		t.Errorf("Service annotations = %v, want no 'key' annotation", svc.GetAnnotations())
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cm", Namespace: "ns"}, cm); err != nil {
+		t.Fatalf("unable to get configmap: %v", err)
+	}
+	if cm.GetLabels()["app.kubernetes.io/managed-by"] != "owner" || cm.GetAnnotations()["key"] != "value" {
+		t.Errorf("ConfigMap labels = %v, annotations = %v", cm.GetLabels(), cm.GetAnnotations())
+	}
+}
@@ -0,0 +1,33 @@
+package reconciler
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	// dynamicWatchErrors counts the failures to register dynamic watches
+	dynamicWatchErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "basereconciler_dynamic_watch_errors_total",
+			Help: "Total number of errors registering dynamic watches for owned resource types",
+		},
+		[]string{"group", "version", "kind"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(dynamicWatchErrors)
+}
+
+// recordWatchError exposes a failure to register a dynamic watch both
+// as a metric and as an event in the owner resource
+func (r *Reconciler) recordWatchError(owner client.Object, gvk schema.GroupVersionKind, err error) {
+	dynamicWatchErrors.WithLabelValues(gvk.Group, gvk.Version, gvk.Kind).Inc()
+	if r.recorder != nil {
+		r.recorder.Eventf(owner, corev1.EventTypeWarning, "WatchFailed", "unable to watch resource type %s: %v", gvk, err)
+	}
+}
@@ -0,0 +1,35 @@
+package reconciler
+
+import (
+	"context"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// mutatingTemplate is a TemplateInterface that applies additional
+// mutations to the object built by the wrapped template
+type mutatingTemplate struct {
+	resource.TemplateInterface
+	mutations []resource.TemplateMutationFunction
+}
+
+// Unwrap returns the wrapped template, so the optional interfaces
+// it implements are still available to resource.CreateOrUpdate
+func (t mutatingTemplate) Unwrap() resource.TemplateInterface {
+	return t.TemplateInterface
+}
+
+// Build implements resource.TemplateInterface
+func (t mutatingTemplate) Build(ctx context.Context, cl client.Client, o client.Object) (client.Object, error) {
+	obj, err := t.TemplateInterface.Build(ctx, cl, o)
+	if err != nil || obj == nil {
+		return obj, err
+	}
+	for _, fn := range t.mutations {
+		if err := fn(ctx, cl, obj); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
@@ -0,0 +1,63 @@
+package reconciler
+
+import (
+	"context"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// EnqueueRequestForLabelOwner returns an EventHandler that produces reconcile requests for the
+// owner of resources that are owned through labels (see resource.SetOwner). Label based ownership
+// is used for cluster scoped resources and for resources that live in a namespace different from
+// the owner's, as OwnerReferences cannot be used in those cases. The ownerType is used to filter
+// out resources owned by objects of other kinds.
+func EnqueueRequestForLabelOwner(scheme *runtime.Scheme, ownerType client.Object) handler.EventHandler {
+	gvk, err := apiutil.GVKForObject(ownerType, scheme)
+	return handler.EnqueueRequestsFromMapFunc(
+		func(ctx context.Context, o client.Object) []reconcile.Request {
+			if err != nil {
+				return []reconcile.Request{}
+			}
+			gk, key, ok := resource.GetLabelOwner(o)
+			if !ok || gk != gvk.GroupKind() {
+				return []reconcile.Request{}
+			}
+			return []reconcile.Request{{NamespacedName: key}}
+		},
+	)
+}
+
+// eventHandlers is an EventHandler that forwards events to
+// a list of EventHandlers
+type eventHandlers []handler.EventHandler
+
+func (hs eventHandlers) Create(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	for _, h := range hs {
+		h.Create(ctx, e, q)
+	}
+}
+
+func (hs eventHandlers) Update(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	for _, h := range hs {
+		h.Update(ctx, e, q)
+	}
+}
+
+func (hs eventHandlers) Delete(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	for _, h := range hs {
+		h.Delete(ctx, e, q)
+	}
+}
+
+func (hs eventHandlers) Generic(ctx context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	for _, h := range hs {
+		h.Generic(ctx, e, q)
+	}
+}
@@ -0,0 +1,63 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestEnqueueRequestForLabelOwner(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  client.Object
+		want []reconcile.Request
+	}{
+		{
+			name: "Enqueues the owner",
+			obj: &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+				Name: "cr", Labels: map[string]string{resource.OwnerUIDLabelKey(): "uid"},
+				Annotations: labelOwnerAnnotations("ServiceAccount", "owner", "ns")}},
+			want: []reconcile.Request{{NamespacedName: types.NamespacedName{Name: "owner", Namespace: "ns"}}},
+		},
+		{
+			name: "Ignores owners of other kinds",
+			obj: &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+				Name: "cr", Labels: map[string]string{resource.OwnerUIDLabelKey(): "uid"},
+				Annotations: labelOwnerAnnotations("Test.example.com", "owner", "ns")}},
+			want: []reconcile.Request{},
+		},
+		{
+			name: "Ignores resources not owned through labels",
+			obj:  &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cr"}},
+			want: []reconcile.Request{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+			defer q.ShutDown()
+			h := EnqueueRequestForLabelOwner(scheme.Scheme, &corev1.ServiceAccount{})
+			h.Create(context.TODO(), event.CreateEvent{Object: tt.obj}, q)
+			got := []reconcile.Request{}
+			for q.Len() > 0 {
+				item, _ := q.Get()
+				got = append(got, item)
+				q.Done(item)
+			}
+			if diff := cmp.Diff(got, tt.want); len(diff) > 0 {
+				t.Errorf("EnqueueRequestForLabelOwner() diff = %v", diff)
+			}
+		})
+	}
+}
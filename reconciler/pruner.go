@@ -3,18 +3,59 @@ package reconciler
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/resource"
 	"github.com/3scale-ops/basereconciler/util"
 	"github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
-func (r *Reconciler) pruneOrphaned(ctx context.Context, owner client.Object, managed []corev1.ObjectReference) error {
+// WithPruneHooks registers hooks that are called with resource.ActionPrune around the deletion of every
+// resource of the given type pruned by the Reconciler. Unlike the hooks of the templates, which are only
+// called while a template that manages resources of the type is in the list passed to ReconcileOwnedResources,
+// these hooks are always called, so they also run when the template of the pruned resource has been removed.
+// The hooks receive the typed object, even for types watched with DynamicWatchOptions.MetadataOnly.
+// It must be called before the controller is started.
+// Example usage:
+//
+//	reconciler.NewFromManager(mgr).
+//		WithPruneHooks(corev1.SchemeGroupVersion.WithKind("PersistentVolumeClaim"),
+//			[]resource.HookFunction{backupVolume}, nil)
+func (r *Reconciler) WithPruneHooks(gvk schema.GroupVersionKind, pre, post []resource.HookFunction) *Reconciler {
+	if r.pruneHooks == nil {
+		r.pruneHooks = map[schema.GroupVersionKind][]resource.TemplateWithHooks{}
+	}
+	r.pruneHooks[gvk] = append(r.pruneHooks[gvk], registeredHooks{pre: pre, post: post})
+	return r
+}
+
+// registeredHooks implements resource.TemplateWithHooks for the hooks registered with WithPruneHooks
+type registeredHooks struct {
+	pre, post []resource.HookFunction
+}
+
+func (h registeredHooks) GetPreHooks() []resource.HookFunction  { return h.pre }
+func (h registeredHooks) GetPostHooks() []resource.HookFunction { return h.post }
+
+// pruneOrphaned deletes the resources owned by the owner that are not in the list of managed resources. The
+// pre and post hooks of the templates that manage resources of the same type, and the ones registered with
+// WithPruneHooks, are called with ActionPrune around the deletion of each resource. The hooks receive the
+// typed object, which is read from the API server if the type is listed with metadata only requests.
+func (r *Reconciler) pruneOrphaned(ctx context.Context, owner client.Object, managed []corev1.ObjectReference,
+	hooks map[schema.GroupVersionKind][]resource.TemplateWithHooks) error {
 	logger := logr.FromContextOrDiscard(ctx)
 
 	ownerGVK, err := apiutil.GVKForObject(owner, r.Scheme)
@@ -22,39 +63,355 @@ func (r *Reconciler) pruneOrphaned(ctx context.Context, owner client.Object, man
 		return fmt.Errorf("unable to get GVK for owner: %w", err)
 	}
 
-	for _, gvk := range r.typeTracker.seenTypes {
+	inUse := generatedReferences{}
+	var managedInUse generatedReferences
 
-		objectList, err := util.NewObjectListFromGVK(gvk, r.Scheme)
-		if err != nil {
-			return fmt.Errorf("unable to get list type for '%s': %w", gvk.String(), err)
-		}
-		err = r.Client.List(ctx, objectList, client.InNamespace(owner.GetNamespace()))
+	for _, gvk := range mergeTypes(r.typeTracker.seenTypes(), labelOwnedTypesOf(owner)) {
+
+		objects, err := r.listOwned(ctx, owner, gvk)
 		if err != nil {
 			return err
 		}
 
-		for _, obj := range util.GetItems(objectList) {
+		for _, obj := range objects {
 
-			owned := util.ContainsBy(obj.GetOwnerReferences(), func(ref metav1.OwnerReference) bool {
-				return ref.Kind == ownerGVK.Kind && ref.Name == owner.GetName() && ref.APIVersion == ownerGVK.GroupVersion().String()
-			})
-			managed := util.ContainsBy(managed, func(ref corev1.ObjectReference) bool {
+			owned := resource.IsOwnedBy(obj, owner, ownerGVK)
+			isManaged := util.ContainsBy(managed, func(ref corev1.ObjectReference) bool {
 				return ref.Name == obj.GetName() && ref.Namespace == obj.GetNamespace() && ref.Kind == gvk.Kind && ref.APIVersion == gvk.GroupVersion().String()
 			})
 
-			// if isOwned(owner, obj) && !util.IsBeingDeleted(obj) && !isManaged(util.ObjectKey(obj), gvk.Kind, managed) {
-			if owned && !util.IsBeingDeleted(obj) && !managed {
+			if owned && !util.IsBeingDeleted(obj) && !isManaged {
+				// old generations of generated objects are kept while they are
+				// still referenced by the managed workloads or, if the reference
+				// check is enabled, by any workload or pod in their namespace
+				if _, ok := obj.GetLabels()[resource.GeneratedFromLabelKey()]; ok && gvk.Group == "" {
+					if managedInUse == nil {
+						if managedInUse, err = r.managedWorkloadReferences(ctx, managed); err != nil {
+							return err
+						}
+					}
+					referenced := managedInUse.contains(obj.GetNamespace(), gvk.Kind, obj.GetName())
+					if !referenced && config.IsGeneratedReferenceCheckEnabled() {
+						if referenced, err = r.isReferenced(ctx, inUse, obj.GetNamespace(), gvk.Kind, obj.GetName()); err != nil {
+							return err
+						}
+					}
+					if referenced {
+						continue
+					}
+				}
+				live := obj
+				if len(hooks[gvk]) > 0 {
+					if live, err = r.typedObject(ctx, obj, gvk); err != nil {
+						return err
+					}
+					if live == nil {
+						continue
+					}
+				}
+				for _, t := range hooks[gvk] {
+					if err := resource.RunHooks(ctx, r.Client, t.GetPreHooks(), resource.ActionPrune, live, nil); err != nil {
+						return fmt.Errorf("pre prune hook failed for %s %s: %w", gvk.Kind, obj.GetName(), err)
+					}
+				}
 				err := r.Client.Delete(ctx, obj)
 				if err != nil {
 					return err
 				}
 				logger.Info("resource deleted", "kind", gvk.Kind, "resource", obj.GetName())
+				for _, t := range hooks[gvk] {
+					if err := resource.RunHooks(ctx, r.Client, t.GetPostHooks(), resource.ActionPrune, live, nil); err != nil {
+						return fmt.Errorf("post prune hook failed for %s %s: %w", gvk.Kind, obj.GetName(), err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// typedObject returns the typed object for the given object, which is read directly from the API server
+// if the object only holds metadata (see DynamicWatchOptions.MetadataOnly). Nil is returned if the object
+// no longer exists.
+func (r *Reconciler) typedObject(ctx context.Context, obj client.Object, gvk schema.GroupVersionKind) (client.Object, error) {
+	if _, ok := obj.(*metav1.PartialObjectMetadata); !ok {
+		return obj, nil
+	}
+	typed, err := util.NewObjectFromGVK(gvk, r.Scheme)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get object for '%s': %w", gvk, err)
+	}
+	if err := r.uncachedReader().Get(ctx, client.ObjectKeyFromObject(obj), typed); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unable to get %s %s: %w", gvk.Kind, client.ObjectKeyFromObject(obj), err)
+	}
+	return typed, nil
+}
+
+// generatedReferences holds, per namespace, the set of Secrets and ConfigMaps
+// referenced by the workloads and pods, in "Kind/name" format
+type generatedReferences map[string]map[string]struct{}
+
+// add adds the Secrets and ConfigMaps referenced by the pod spec
+func (refs generatedReferences) add(namespace string, spec *corev1.PodSpec) {
+	set, ok := refs[namespace]
+	if !ok {
+		set = map[string]struct{}{}
+		refs[namespace] = set
+	}
+	secrets, configMaps := util.PodSpecReferences(spec)
+	for _, s := range secrets {
+		set["Secret/"+s] = struct{}{}
+	}
+	for _, cm := range configMaps {
+		set["ConfigMap/"+cm] = struct{}{}
+	}
+	for _, s := range spec.ImagePullSecrets {
+		set["Secret/"+s.Name] = struct{}{}
+	}
+}
+
+func (refs generatedReferences) contains(namespace, kind, name string) bool {
+	_, ok := refs[namespace][kind+"/"+name]
+	return ok
+}
+
+// managedWorkloadReferences returns the Secrets and ConfigMaps referenced by the pod templates
+// of the live Deployments, StatefulSets, DaemonSets, Jobs and CronJobs in the list of managed
+// resources. The workloads are read through the client, as their types are already watched.
+func (r *Reconciler) managedWorkloadReferences(ctx context.Context, managed []corev1.ObjectReference) (generatedReferences, error) {
+	refs := generatedReferences{}
+	for _, ref := range managed {
+		gvk := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind)
+		if gvk.Group != appsv1.GroupName && gvk.Group != batchv1.GroupName {
+			continue
+		}
+		obj, err := util.NewObjectFromGVK(gvk, r.Scheme)
+		if err != nil || workloadPodSpec(obj) == nil {
+			continue
+		}
+		key := types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}
+		if err := (metadataOnlyClient{Client: r.Client, r: r}).Get(ctx, key, obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to get %s %s: %w", ref.Kind, key, err)
+		}
+		refs.add(ref.Namespace, workloadPodSpec(obj))
+	}
+	return refs, nil
+}
+
+// workloadPodSpec returns the pod spec in the pod template of the workload,
+// or nil if the object is not of one of the supported workload types
+func workloadPodSpec(o client.Object) *corev1.PodSpec {
+	switch o := o.(type) {
+	case *appsv1.Deployment:
+		return &o.Spec.Template.Spec
+	case *appsv1.StatefulSet:
+		return &o.Spec.Template.Spec
+	case *appsv1.DaemonSet:
+		return &o.Spec.Template.Spec
+	case *batchv1.Job:
+		return &o.Spec.Template.Spec
+	case *batchv1.CronJob:
+		return &o.Spec.JobTemplate.Spec.Template.Spec
+	}
+	return nil
+}
+
+// isReferenced returns true if the Secret or ConfigMap is referenced by any Pod, ReplicaSet with
+// replicas, Deployment, StatefulSet, DaemonSet, Job or CronJob in the namespace. The references of
+// each namespace are only listed once and stored in refs. The objects are read without the cache
+// to avoid starting informers for all those types (see config.EnableGeneratedReferenceCheck).
+func (r *Reconciler) isReferenced(ctx context.Context, refs generatedReferences, namespace, kind, name string) (bool, error) {
+	reader := r.uncachedReader()
+	if _, ok := refs[namespace]; !ok {
+		add := func(spec *corev1.PodSpec) { refs.add(namespace, spec) }
+
+		pods := &corev1.PodList{}
+		if err := reader.List(ctx, pods, client.InNamespace(namespace)); err != nil {
+			return false, fmt.Errorf("unable to list pods: %w", err)
+		}
+		for i := range pods.Items {
+			if phase := pods.Items[i].Status.Phase; phase != corev1.PodSucceeded && phase != corev1.PodFailed {
+				add(&pods.Items[i].Spec)
+			}
+		}
+
+		replicaSets := &appsv1.ReplicaSetList{}
+		if err := reader.List(ctx, replicaSets, client.InNamespace(namespace)); err != nil {
+			return false, fmt.Errorf("unable to list replicasets: %w", err)
+		}
+		for i := range replicaSets.Items {
+			if rs := &replicaSets.Items[i]; (rs.Spec.Replicas == nil || *rs.Spec.Replicas > 0) || rs.Status.Replicas > 0 {
+				add(&rs.Spec.Template.Spec)
+			}
+		}
+
+		lists := []client.ObjectList{&appsv1.DeploymentList{}, &appsv1.StatefulSetList{}, &appsv1.DaemonSetList{}, &batchv1.JobList{}, &batchv1.CronJobList{}}
+		for _, list := range lists {
+			if err := reader.List(ctx, list, client.InNamespace(namespace)); err != nil {
+				return false, fmt.Errorf("unable to list workloads: %w", err)
+			}
+			for _, o := range util.GetItems(list) {
+				add(workloadPodSpec(o))
+			}
+		}
+		if _, ok := refs[namespace]; !ok {
+			refs[namespace] = map[string]struct{}{}
+		}
+	}
+
+	return refs.contains(namespace, kind, name), nil
+}
+
+// listOwned returns the list of objects of the given type that are candidates to be owned by
+// the owner: the objects in the owner's namespace plus, if resources of this type have been seen
+// owned through labels, the objects in any namespace carrying the owner label. No objects are
+// returned for types that are no longer served by the API.
+func (r *Reconciler) listOwned(ctx context.Context, owner client.Object, gvk schema.GroupVersionKind) ([]client.Object, error) {
+	objectList, err := r.newWatchedObjectList(gvk)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get list type for '%s': %w", gvk.String(), err)
+	}
+	err = r.Client.List(ctx, objectList, client.InNamespace(owner.GetNamespace()))
+	if err != nil {
+		if meta.IsNoMatchError(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	objects := watchedObjectListItems(objectList, gvk)
+
+	if r.typeTracker.isLabelOwnedType(gvk) || util.ContainsBy(labelOwnedTypesOf(owner), func(x schema.GroupVersionKind) bool { return x == gvk }) {
+		labelOwned, err := r.listLabelOwned(ctx, owner, gvk)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range labelOwned {
+			if obj.GetNamespace() != owner.GetNamespace() {
+				objects = append(objects, obj)
+			}
+		}
+	}
+
+	return objects, nil
+}
+
+// listLabelOwned returns the objects of the given type that are owned by the owner through labels
+func (r *Reconciler) listLabelOwned(ctx context.Context, owner client.Object, gvk schema.GroupVersionKind) ([]client.Object, error) {
+	objectList, err := r.newWatchedObjectList(gvk)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get list type for '%s': %w", gvk.String(), err)
+	}
+	err = r.Client.List(ctx, objectList, client.MatchingLabels{resource.OwnerUIDLabelKey(): string(owner.GetUID())})
+	if err != nil {
+		return nil, err
+	}
+	return watchedObjectListItems(objectList, gvk), nil
+}
+
+// deleteLabelOwned deletes all the resources owned by the owner through labels. Kubernetes
+// garbage collection does not work for these, so they need to be explicitly deleted when the
+// owner is deleted. The types listed in the owner's LabelOwnedTypesAnnotationKey annotation are
+// also checked, as the type tracker is empty after a restart of the controller.
+func (r *Reconciler) deleteLabelOwned(ctx context.Context, owner client.Object) error {
+	logger := logr.FromContextOrDiscard(ctx)
+
+	ownerGVK, err := apiutil.GVKForObject(owner, r.Scheme)
+	if err != nil {
+		return fmt.Errorf("unable to get GVK for owner: %w", err)
+	}
+
+	for _, gvk := range mergeTypes(r.typeTracker.labelOwnedTypes(), labelOwnedTypesOf(owner)) {
+		objects, err := r.listLabelOwned(ctx, owner, gvk)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				// the type is no longer served by the API
+				continue
+			}
+			return err
+		}
+		for _, obj := range objects {
+			if resource.IsOwnedBy(obj, owner, ownerGVK) && !util.IsBeingDeleted(obj) {
+				if err := r.Client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+					return err
+				}
+				logger.Info("resource deleted", "kind", gvk.Kind, "resource", obj.GetName())
 			}
 		}
 	}
 	return nil
 }
 
+// LabelOwnedTypesAnnotationKey returns the annotation of the owner that holds the comma separated list of
+// the resource types, in "Kind.version.group" format, that the owner has owned through labels. The list
+// is persisted in the owner so the resources owned through labels are found by the resource pruner and
+// deleted along with the owner even after a restart of the controller.
+func LabelOwnedTypesAnnotationKey() string {
+	return fmt.Sprintf("%s/label-owned-types", config.GetAnnotationsDomain())
+}
+
+// labelOwnedTypesOf returns the types listed in the LabelOwnedTypesAnnotationKey
+// annotation of the owner, sorted
+func labelOwnedTypesOf(owner client.Object) []schema.GroupVersionKind {
+	value := owner.GetAnnotations()[LabelOwnedTypesAnnotationKey()]
+	if value == "" {
+		return nil
+	}
+	list := []schema.GroupVersionKind{}
+	for _, s := range strings.Split(value, ",") {
+		if gvk, _ := schema.ParseKindArg(s); gvk != nil {
+			list = append(list, *gvk)
+		}
+	}
+	return mergeTypes(list)
+}
+
+// recordLabelOwnedType adds the type to the LabelOwnedTypesAnnotationKey
+// annotation of the owner, if it is not already there
+func (r *Reconciler) recordLabelOwnedType(ctx context.Context, owner client.Object, gvk schema.GroupVersionKind) error {
+	types := labelOwnedTypesOf(owner)
+	if util.ContainsBy(types, func(x schema.GroupVersionKind) bool { return x == gvk }) {
+		return nil
+	}
+	values := []string{}
+	for _, t := range mergeTypes(types, []schema.GroupVersionKind{gvk}) {
+		values = append(values, fmt.Sprintf("%s.%s.%s", t.Kind, t.Version, t.Group))
+	}
+	annotations := util.MergeMaps(map[string]string{}, owner.GetAnnotations(),
+		map[string]string{LabelOwnedTypesAnnotationKey(): strings.Join(values, ",")})
+	// patch a copy, as the response of the API server would overwrite
+	// the in memory state of the owner (see WithInMemoryInitializationFunc)
+	o := owner.DeepCopyObject().(client.Object)
+	patch := client.MergeFrom(owner.DeepCopyObject().(client.Object))
+	o.SetAnnotations(annotations)
+	if err := r.Client.Patch(ctx, o, patch); err != nil {
+		return fmt.Errorf("unable to record label owned type %s: %w", gvk, err)
+	}
+	owner.SetAnnotations(annotations)
+	return nil
+}
+
+// mergeTypes returns the sorted list of unique types in the given lists
+func mergeTypes(lists ...[]schema.GroupVersionKind) []schema.GroupVersionKind {
+	set := map[schema.GroupVersionKind]struct{}{}
+	for _, list := range lists {
+		for _, gvk := range list {
+			set[gvk] = struct{}{}
+		}
+	}
+	merged := make([]schema.GroupVersionKind, 0, len(set))
+	for gvk := range set {
+		merged = append(merged, gvk)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].String() < merged[j].String() })
+	return merged
+}
+
 func isPrunerEnabled(owner client.Object) bool {
 	// prune is active by default
 	prune := true
@@ -2,28 +2,39 @@ package reconciler
 
 import (
 	"context"
-	"reflect"
+	"fmt"
 	"testing"
 
 	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/google/go-cmp/cmp"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv2 "k8s.io/api/autoscaling/v2"
 	corev1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
 )
 
 func TestReconciler_pruneOrphaned(t *testing.T) {
 	type fields struct {
-		Client    client.Client
-		Scheme    *runtime.Scheme
-		seenTypes []schema.GroupVersionKind
+		Client          client.Client
+		Scheme          *runtime.Scheme
+		seenTypes       []schema.GroupVersionKind
+		labelOwnedTypes []schema.GroupVersionKind
+		watchOptions    map[schema.GroupVersionKind]DynamicWatchOptions
+		referenceCheck  bool
 	}
 	type args struct {
 		ctx     context.Context
@@ -118,6 +129,126 @@ func TestReconciler_pruneOrphaned(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Keeps old generations of generated objects while referenced",
+			fields: fields{
+				Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+						Name: "config-new", Namespace: "ns", Labels: map[string]string{resource.GeneratedFromLabelKey(): "config"},
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+						Name: "config-old", Namespace: "ns", Labels: map[string]string{resource.GeneratedFromLabelKey(): "config"},
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+						Name: "config-older", Namespace: "ns", Labels: map[string]string{resource.GeneratedFromLabelKey(): "config"},
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"},
+						Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "config-old"}}}}}}},
+				).Build(),
+				Scheme: scheme.Scheme,
+				seenTypes: []schema.GroupVersionKind{
+					schema.FromAPIVersionAndKind("v1", "ConfigMap"),
+				},
+				referenceCheck: true,
+			},
+			args: args{
+				ctx: context.TODO(),
+				owner: &corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"},
+				},
+				managed: []corev1.ObjectReference{
+					{Namespace: "ns", Name: "config-new", Kind: "ConfigMap", APIVersion: "v1"},
+				},
+			},
+			want: []check{
+				{absent: false, obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-new", Namespace: "ns"}}},
+				{absent: false, obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-old", Namespace: "ns"}}},
+				{absent: true, obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-older", Namespace: "ns"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Prunes old generations of generated objects if the reference check is disabled",
+			fields: fields{
+				Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+						Name: "config-new", Namespace: "ns", Labels: map[string]string{resource.GeneratedFromLabelKey(): "config"},
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+						Name: "config-old", Namespace: "ns", Labels: map[string]string{resource.GeneratedFromLabelKey(): "config"},
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+						Name: "config-older", Namespace: "ns", Labels: map[string]string{resource.GeneratedFromLabelKey(): "config"},
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"},
+						Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "config-old"}}}}}}},
+				).Build(),
+				Scheme: scheme.Scheme,
+				seenTypes: []schema.GroupVersionKind{
+					schema.FromAPIVersionAndKind("v1", "ConfigMap"),
+				},
+			},
+			args: args{
+				ctx: context.TODO(),
+				owner: &corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"},
+				},
+				managed: []corev1.ObjectReference{
+					{Namespace: "ns", Name: "config-new", Kind: "ConfigMap", APIVersion: "v1"},
+				},
+			},
+			want: []check{
+				{absent: false, obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-new", Namespace: "ns"}}},
+				{absent: true, obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-old", Namespace: "ns"}}},
+				{absent: true, obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-older", Namespace: "ns"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Keeps old generations of generated objects referenced by the managed workloads",
+			fields: fields{
+				Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+						Name: "config-new", Namespace: "ns", Labels: map[string]string{resource.GeneratedFromLabelKey(): "config"},
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+						Name: "config-old", Namespace: "ns", Labels: map[string]string{resource.GeneratedFromLabelKey(): "config"},
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+						Name: "config-older", Namespace: "ns", Labels: map[string]string{resource.GeneratedFromLabelKey(): "config"},
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{
+						Name: "deploy", Namespace: "ns",
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}},
+						Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: "config", VolumeSource: corev1.VolumeSource{
+							ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "config-old"}}}}}}}}},
+				).Build(),
+				Scheme: scheme.Scheme,
+				seenTypes: []schema.GroupVersionKind{
+					schema.FromAPIVersionAndKind("v1", "ConfigMap"),
+					schema.FromAPIVersionAndKind("apps/v1", "Deployment"),
+				},
+			},
+			args: args{
+				ctx: context.TODO(),
+				owner: &corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"},
+				},
+				managed: []corev1.ObjectReference{
+					{Namespace: "ns", Name: "config-new", Kind: "ConfigMap", APIVersion: "v1"},
+					{Namespace: "ns", Name: "deploy", Kind: "Deployment", APIVersion: "apps/v1"},
+				},
+			},
+			want: []check{
+				{absent: false, obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-new", Namespace: "ns"}}},
+				{absent: false, obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-old", Namespace: "ns"}}},
+				{absent: true, obj: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config-older", Namespace: "ns"}}},
+				{absent: false, obj: &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "deploy", Namespace: "ns"}}},
+			},
+			wantErr: false,
+		},
 		{
 			name: "Does nothing",
 			fields: fields{
@@ -163,15 +294,107 @@ func TestReconciler_pruneOrphaned(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Prunes resources owned through labels",
+			fields: fields{
+				Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+					&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+						Name: "managed", Labels: map[string]string{resource.OwnerUIDLabelKey(): "uid"},
+						Annotations: labelOwnerAnnotations("ServiceAccount", "owner", "ns")}},
+					&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+						Name: "orphan", Labels: map[string]string{resource.OwnerUIDLabelKey(): "uid"},
+						Annotations: labelOwnerAnnotations("ServiceAccount", "owner", "ns")}},
+					&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+						Name: "other", Labels: map[string]string{resource.OwnerUIDLabelKey(): "other-uid"},
+						Annotations: labelOwnerAnnotations("ServiceAccount", "owner", "other")}},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+						Name: "orphan", Namespace: "other-ns", Labels: map[string]string{resource.OwnerUIDLabelKey(): "uid"},
+						Annotations: labelOwnerAnnotations("ServiceAccount", "owner", "ns")}},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+						Name: "orphan", Namespace: "ns",
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+				).Build(),
+				Scheme: scheme.Scheme,
+				seenTypes: []schema.GroupVersionKind{
+					schema.FromAPIVersionAndKind("rbac.authorization.k8s.io/v1", "ClusterRole"),
+					schema.FromAPIVersionAndKind("v1", "Secret"),
+				},
+				labelOwnedTypes: []schema.GroupVersionKind{
+					schema.FromAPIVersionAndKind("rbac.authorization.k8s.io/v1", "ClusterRole"),
+					schema.FromAPIVersionAndKind("v1", "Secret"),
+				},
+			},
+			args: args{
+				ctx: context.TODO(),
+				owner: &corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"},
+				},
+				managed: []corev1.ObjectReference{
+					{Name: "managed", Kind: "ClusterRole", APIVersion: "rbac.authorization.k8s.io/v1"},
+				},
+			},
+			want: []check{
+				{absent: false, obj: &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "managed"}}},
+				{absent: true, obj: &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "orphan"}}},
+				{absent: false, obj: &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "other"}}},
+				{absent: true, obj: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "other-ns"}}},
+				{absent: true, obj: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "ns"}}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Prunes resources using metadata only requests",
+			fields: fields{
+				Client: fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+						Name: "managed", Namespace: "ns",
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+					&corev1.Secret{ObjectMeta: metav1.ObjectMeta{
+						Name: "orphan", Namespace: "ns",
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+				).Build(),
+				Scheme: scheme.Scheme,
+				seenTypes: []schema.GroupVersionKind{
+					schema.FromAPIVersionAndKind("v1", "Secret"),
+				},
+				watchOptions: map[schema.GroupVersionKind]DynamicWatchOptions{
+					schema.FromAPIVersionAndKind("v1", "Secret"): {MetadataOnly: true},
+				},
+			},
+			args: args{
+				ctx: context.TODO(),
+				owner: &corev1.ServiceAccount{
+					ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"},
+				},
+				managed: []corev1.ObjectReference{
+					{Namespace: "ns", Name: "managed", Kind: "Secret", APIVersion: "v1"},
+				},
+			},
+			want: []check{
+				{absent: false, obj: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "managed", Namespace: "ns"}}},
+				{absent: true, obj: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "ns"}}},
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			if tt.fields.referenceCheck {
+				config.EnableGeneratedReferenceCheck()
+				defer config.DisableGeneratedReferenceCheck()
+			}
 			r := &Reconciler{
-				Client:      tt.fields.Client,
-				Scheme:      tt.fields.Scheme,
-				typeTracker: typeTracker{seenTypes: tt.fields.seenTypes},
+				Client:       tt.fields.Client,
+				Scheme:       tt.fields.Scheme,
+				watchOptions: tt.fields.watchOptions,
 			}
-			if err := r.pruneOrphaned(tt.args.ctx, tt.args.owner, tt.args.managed); (err != nil) != tt.wantErr {
+			for _, gvk := range tt.fields.seenTypes {
+				r.typeTracker.trackType(gvk)
+			}
+			for _, gvk := range tt.fields.labelOwnedTypes {
+				r.typeTracker.trackLabelOwnedType(gvk)
+			}
+			if err := r.pruneOrphaned(tt.args.ctx, tt.args.owner, tt.args.managed, nil); (err != nil) != tt.wantErr {
 				t.Errorf("Reconciler.pruneOrphaned() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
@@ -185,6 +408,101 @@ func TestReconciler_pruneOrphaned(t *testing.T) {
 	}
 }
 
+func TestReconciler_deleteLabelOwned(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+			Name: "owned", Labels: map[string]string{resource.OwnerUIDLabelKey(): "uid"},
+			Annotations: labelOwnerAnnotations("ServiceAccount", "owner", "ns")}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+			Name: "other", Labels: map[string]string{resource.OwnerUIDLabelKey(): "other-uid"},
+			Annotations: labelOwnerAnnotations("ServiceAccount", "other", "ns")}},
+	).Build()
+	r := &Reconciler{
+		Client: cl,
+		Scheme: scheme.Scheme,
+	}
+	r.typeTracker.trackLabelOwnedType(schema.FromAPIVersionAndKind("rbac.authorization.k8s.io/v1", "ClusterRole"))
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"}}
+
+	if err := r.deleteLabelOwned(context.TODO(), owner); err != nil {
+		t.Errorf("Reconciler.deleteLabelOwned() error = %v", err)
+	}
+	if err := cl.Get(context.TODO(), client.ObjectKey{Name: "owned"}, &rbacv1.ClusterRole{}); !errors.IsNotFound(err) {
+		t.Errorf("Reconciler.deleteLabelOwned() want 'owned' to be absent")
+	}
+	if err := cl.Get(context.TODO(), client.ObjectKey{Name: "other"}, &rbacv1.ClusterRole{}); err != nil {
+		t.Errorf("Reconciler.deleteLabelOwned() want 'other' to be present")
+	}
+}
+
+func TestReconciler_deleteLabelOwned_afterRestart(t *testing.T) {
+	cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+			Name: "owned", Labels: map[string]string{resource.OwnerUIDLabelKey(): "uid"},
+			Annotations: labelOwnerAnnotations("ServiceAccount", "owner", "ns")}},
+	).Build()
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"}}
+	if err := cl.Create(context.TODO(), owner); err != nil {
+		t.Fatalf("unable to create owner: %v", err)
+	}
+
+	// record the type as a previous instance of the controller would have done
+	previous := &Reconciler{Client: cl, Scheme: scheme.Scheme}
+	owner.SetLabels(map[string]string{"in-memory": "true"})
+	if err := previous.recordLabelOwnedType(context.TODO(), owner, schema.FromAPIVersionAndKind("rbac.authorization.k8s.io/v1", "ClusterRole")); err != nil {
+		t.Fatalf("Reconciler.recordLabelOwnedType() error = %v", err)
+	}
+	if owner.GetLabels()["in-memory"] != "true" {
+		t.Errorf("Reconciler.recordLabelOwnedType() overwrote the in memory state of the owner")
+	}
+	if got, want := owner.GetAnnotations()[LabelOwnedTypesAnnotationKey()], "ClusterRole.v1.rbac.authorization.k8s.io"; got != want {
+		t.Errorf("Reconciler.recordLabelOwnedType() annotation = %q, want %q", got, want)
+	}
+
+	// a new Reconciler starts with an empty type tracker
+	r := &Reconciler{Client: cl, Scheme: scheme.Scheme}
+	if err := cl.Get(context.TODO(), client.ObjectKeyFromObject(owner), owner); err != nil {
+		t.Fatalf("unable to get owner: %v", err)
+	}
+	if err := r.deleteLabelOwned(context.TODO(), owner); err != nil {
+		t.Errorf("Reconciler.deleteLabelOwned() error = %v", err)
+	}
+	if err := cl.Get(context.TODO(), client.ObjectKey{Name: "owned"}, &rbacv1.ClusterRole{}); !errors.IsNotFound(err) {
+		t.Errorf("Reconciler.deleteLabelOwned() want 'owned' to be absent")
+	}
+}
+
+func TestReconciler_pruneOrphaned_uninstalledType(t *testing.T) {
+	gvk := schema.FromAPIVersionAndKind("example.com/v1", "Test")
+	cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithInterceptorFuncs(interceptor.Funcs{
+		List: func(ctx context.Context, cl client.WithWatch, list client.ObjectList, opts ...client.ListOption) error {
+			if list.GetObjectKind().GroupVersionKind().Group == gvk.Group {
+				return &meta.NoKindMatchError{GroupKind: gvk.GroupKind(), SearchedVersions: []string{gvk.Version}}
+			}
+			return cl.List(ctx, list, opts...)
+		},
+	}).Build()
+	r := &Reconciler{Client: cl, Scheme: scheme.Scheme,
+		watchOptions: map[schema.GroupVersionKind]DynamicWatchOptions{gvk: {MetadataOnly: true}}}
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid",
+		Annotations: map[string]string{LabelOwnedTypesAnnotationKey(): "Test.v1.example.com"}}}
+
+	if err := r.pruneOrphaned(context.TODO(), owner, nil, nil); err != nil {
+		t.Errorf("Reconciler.pruneOrphaned() error = %v", err)
+	}
+	if err := r.deleteLabelOwned(context.TODO(), owner); err != nil {
+		t.Errorf("Reconciler.deleteLabelOwned() error = %v", err)
+	}
+}
+
+func labelOwnerAnnotations(kind, name, namespace string) map[string]string {
+	return map[string]string{
+		resource.OwnerKindAnnotationKey():      kind,
+		resource.OwnerNameAnnotationKey():      name,
+		resource.OwnerNamespaceAnnotationKey(): namespace,
+	}
+}
+
 func Test_isPrunerEnabled(t *testing.T) {
 	type args struct {
 		owner client.Object
@@ -236,58 +554,89 @@ func Test_isPrunerEnabled(t *testing.T) {
 	}
 }
 
-func Test_typeTracker_trackType(t *testing.T) {
-	type fields struct {
-		seenTypes []schema.GroupVersionKind
+func TestReconciler_pruneOrphaned_hooks(t *testing.T) {
+	ownerRefs := []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "managed", Namespace: "ns", OwnerReferences: ownerRefs}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "ns", OwnerReferences: ownerRefs}},
+	).Build()
+	r := &Reconciler{Client: cl, Scheme: scheme.Scheme}
+	gvk := schema.FromAPIVersionAndKind("v1", "ConfigMap")
+	r.typeTracker.trackType(gvk)
+
+	calls := []string{}
+	hook := func(when string) resource.HookFunction {
+		return func(_ context.Context, _ client.Client, action resource.Action, live, desired client.Object) error {
+			calls = append(calls, fmt.Sprintf("%s %s %s %v", when, action, live.GetName(), desired == nil))
+			return nil
+		}
 	}
-	type args struct {
-		gvk schema.GroupVersionKind
+	template := resource.NewTemplateFromObjectFunction(func() *corev1.ConfigMap { return &corev1.ConfigMap{} }).
+		WithPreHook(hook("pre")).WithPostHook(hook("post"))
+
+	err := r.pruneOrphaned(context.TODO(), &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+		[]corev1.ObjectReference{{Namespace: "ns", Name: "managed", Kind: "ConfigMap", APIVersion: "v1"}},
+		map[schema.GroupVersionKind][]resource.TemplateWithHooks{gvk: {template}})
+	if err != nil {
+		t.Fatalf("Reconciler.pruneOrphaned() error = %v", err)
 	}
-	tests := []struct {
-		name   string
-		fields fields
-		args   args
-		want   []schema.GroupVersionKind
-	}{
-		{
-			name: "Adds the type",
-			fields: fields{
-				seenTypes: []schema.GroupVersionKind{
-					{Group: "", Version: "v1", Kind: "ServiceAccount"},
-				},
-			},
-			args: args{
-				gvk: schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Service"},
-			},
-			want: []schema.GroupVersionKind{
-				{Group: "", Version: "v1", Kind: "ServiceAccount"},
-				{Group: "", Version: "v1", Kind: "Service"},
-			},
-		},
-		{
-			name: "Does nothing",
-			fields: fields{
-				seenTypes: []schema.GroupVersionKind{
-					{Group: "", Version: "v1", Kind: "Service"},
-				},
-			},
-			args: args{
-				gvk: schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Service"},
-			},
-			want: []schema.GroupVersionKind{
-				{Group: "", Version: "v1", Kind: "Service"},
-			},
-		},
+	if diff := cmp.Diff(calls, []string{"pre Prune orphan true", "post Prune orphan true"}); len(diff) > 0 {
+		t.Errorf("Reconciler.pruneOrphaned() hook calls diff = %v", diff)
 	}
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			tracker := &typeTracker{
-				seenTypes: tt.fields.seenTypes,
-			}
-			tracker.trackType(tt.args.gvk)
-			if !reflect.DeepEqual(tracker.seenTypes, tt.want) {
-				t.Errorf("(*typeTracker).trackType() = %v, want %v", tracker.seenTypes, tt.want)
+
+	// a pre hook error vetoes the deletion
+	template.PreHooks = []resource.HookFunction{func(context.Context, client.Client, resource.Action, client.Object, client.Object) error {
+		return fmt.Errorf("veto")
+	}}
+	cl.Create(context.TODO(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "orphan", Namespace: "ns", OwnerReferences: ownerRefs}})
+	err = r.pruneOrphaned(context.TODO(), &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+		[]corev1.ObjectReference{{Namespace: "ns", Name: "managed", Kind: "ConfigMap", APIVersion: "v1"}},
+		map[schema.GroupVersionKind][]resource.TemplateWithHooks{gvk: {template}})
+	if err == nil {
+		t.Errorf("Reconciler.pruneOrphaned() expected error")
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "orphan", Namespace: "ns"}, &corev1.ConfigMap{}); err != nil {
+		t.Errorf("Reconciler.pruneOrphaned() expected orphan not to be deleted, got err %v", err)
+	}
+}
+
+func TestReconciler_ReconcileOwnedResources_pruneHooks(t *testing.T) {
+	config.EnableResourcePruner()
+	mgr, _ := ctrl.NewManager(&rest.Config{}, ctrl.Options{})
+	ownerRefs := []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}
+	cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "ns", OwnerReferences: ownerRefs},
+			Spec: corev1.PersistentVolumeClaimSpec{VolumeName: "pv"}},
+	).Build()
+	gvk := schema.FromAPIVersionAndKind("v1", "PersistentVolumeClaim")
+
+	calls := []string{}
+	hook := func(when string) resource.HookFunction {
+		return func(_ context.Context, _ client.Client, action resource.Action, live, _ client.Object) error {
+			pvc, ok := live.(*corev1.PersistentVolumeClaim)
+			if !ok {
+				return fmt.Errorf("got %T, want typed object", live)
 			}
-		})
+			calls = append(calls, fmt.Sprintf("%s %s %s %s", when, action, pvc.GetName(), pvc.Spec.VolumeName))
+			return nil
+		}
+	}
+	r := (&Reconciler{Client: cl, Scheme: scheme.Scheme, mgr: mgr}).
+		WithAPIReader(cl).
+		WithDynamicWatchOptions(gvk, DynamicWatchOptions{MetadataOnly: true}).
+		WithPruneHooks(gvk, []resource.HookFunction{hook("pre")}, []resource.HookFunction{hook("post")})
+	r.BuildTypeTracker(&testController{})
+	r.typeTracker.trackType(gvk)
+
+	// the template of the PVC has been removed
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}}
+	if got := r.ReconcileOwnedResources(context.TODO(), owner, []resource.TemplateInterface{}); got.Error != nil {
+		t.Fatalf("Reconciler.ReconcileOwnedResources() error = %v", got.Error)
+	}
+	if diff := cmp.Diff(calls, []string{"pre Prune data pv", "post Prune data pv"}); len(diff) > 0 {
+		t.Errorf("Reconciler.ReconcileOwnedResources() hook calls diff = %v", diff)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "data", Namespace: "ns"}, &corev1.PersistentVolumeClaim{}); !errors.IsNotFound(err) {
+		t.Errorf("Reconciler.ReconcileOwnedResources() expected the PVC to be pruned, got err %v", err)
 	}
 }
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/mutators"
 	"github.com/3scale-ops/basereconciler/resource"
 	"github.com/3scale-ops/basereconciler/util"
 	"github.com/go-logr/logr"
@@ -15,6 +16,8 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -54,11 +57,14 @@ type lifecycleOptions struct {
 	initializationLogic         []initializationFunction
 	inMemoryinitializationLogic []inMemoryinitializationFunction
 	finalizer                   *string
-	finalizationLogic           []finalizationFunction
+	finalizationLogic           []finalizationStep
+	finalizationDeadline        *finalizationDeadline
+	// errors holds the errors found while applying the options
+	errors []error
 }
 
 func newLifecycleOptions() *lifecycleOptions {
-	return &lifecycleOptions{finalizationLogic: []finalizationFunction{}}
+	return &lifecycleOptions{finalizationLogic: []finalizationStep{}}
 }
 
 // lifecycleOption is an interface that defines options that can be passed to
@@ -90,11 +96,14 @@ func (f finalizer) initFinalizer(ctx context.Context, c client.Client, o client.
 type finalizationFunction func(context.Context, client.Client) error
 
 func (fn finalizationFunction) applyToLifecycleOptions(opts *lifecycleOptions) {
-	opts.finalizationLogic = append(opts.finalizationLogic, fn)
+	opts.finalizationLogic = append(opts.finalizationLogic, finalizationStep{
+		fn: func(ctx context.Context, cl client.Client, _ client.Object) error { return fn(ctx, cl) },
+	})
 }
 
 // WithFinalizationFunc can be used to provide functions that will be run on object finalization. A Finalizer must be set for
-// these functions to be called.
+// these functions to be called. The functions are run in every reconcile until all the finalization logic succeeds, use
+// WithFinalizationStep for finalization logic that needs the custom resource or reports its progress.
 func WithFinalizationFunc(fn func(context.Context, client.Client) error) finalizationFunction {
 	return fn
 }
@@ -123,18 +132,61 @@ func WithInMemoryInitializationFunc(fn func(context.Context, client.Client, clie
 	return fn
 }
 
+type reconcileOptions struct {
+	rolloutRestart *string
+}
+
+// reconcileOption is an interface that defines options that can be passed to
+// the reconciler's ReconcileOwnedResources() function
+type reconcileOption interface {
+	applyToReconcileOptions(*reconcileOptions)
+}
+
+type rolloutRestart string
+
+func (rr rolloutRestart) applyToReconcileOptions(opts *reconcileOptions) {
+	opts.rolloutRestart = util.Pointer(string(rr))
+}
+
+// WithRolloutRestart enables on-demand rollout restarts of the Deployments, StatefulSets and DaemonSets
+// owned by the resource: the rollout restart annotation of the resource (see mutators.RolloutRestartAnnotationKey)
+// is copied to the pod templates of those workloads by ReconcileOwnedResources, so changing its value performs
+// a rolling restart that is not reverted by the reconciler. It must be passed to ReconcileOwnedResources. The
+// annotations domain can be passed as parameter, otherwise the globally configured annotations domain is used.
+func WithRolloutRestart(params ...string) rolloutRestart {
+	if len(params) == 0 {
+		return rolloutRestart(config.GetAnnotationsDomain())
+	}
+	return rolloutRestart(params[0])
+}
+
 // Reconciler computes a list of resources that it needs to keep in place
 type Reconciler struct {
 	client.Client
-	Log         logr.Logger
-	Scheme      *runtime.Scheme
-	typeTracker typeTracker
-	mgr         manager.Manager
+	Log             logr.Logger
+	Scheme          *runtime.Scheme
+	typeTracker     typeTracker
+	mgr             manager.Manager
+	apiReader       client.Reader
+	recorder        record.EventRecorder
+	watchOptions    map[schema.GroupVersionKind]DynamicWatchOptions
+	references      referenceTracker
+	informers       informerUsers
+	globalMutations []globalMutation
+	pruneHooks      map[schema.GroupVersionKind][]resource.TemplateWithHooks
 }
 
 // NewFromManager returns a new Reconciler from a controller-runtime manager.Manager
 func NewFromManager(mgr manager.Manager) *Reconciler {
-	return &Reconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme(), Log: logr.Discard(), mgr: mgr}
+	return &Reconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme(), Log: logr.Discard(), mgr: mgr,
+		apiReader: mgr.GetAPIReader(), recorder: mgr.GetEventRecorderFor("basereconciler")}
+}
+
+// WithAPIReader sets the reader used by the Reconciler to read objects directly from the API server,
+// bypassing the cache. It defaults to the manager's API reader (see manager.Manager.GetAPIReader).
+func (r *Reconciler) WithAPIReader(reader client.Reader) *Reconciler {
+	r.apiReader = reader
+	return r
 }
 
 // WithLogger sets the Reconciler logger
@@ -143,6 +195,13 @@ func (r *Reconciler) WithLogger(logger logr.Logger) *Reconciler {
 	return r
 }
 
+// WithEventRecorder sets the Reconciler event recorder. The event recorder is used
+// to publish events on the custom resources when some errors occur.
+func (r *Reconciler) WithEventRecorder(recorder record.EventRecorder) *Reconciler {
+	r.recorder = recorder
+	return r
+}
+
 // Logger returns the Reconciler logger and a copy of the context that also includes the logger inside to pass it around easily.
 func (r *Reconciler) Logger(ctx context.Context, keysAndValues ...interface{}) (context.Context, logr.Logger) {
 	var logger logr.Logger
@@ -170,6 +229,15 @@ func (r *Reconciler) Logger(ctx context.Context, keysAndValues ...interface{}) (
 //   - WithFinalizationFunc(...): pass finalization functions that will be
 //     run when the custom resource is being deleted. Only works ifa finalizer is also passed, otherwise
 //     the custom resource will be immediately deleted and the functions won't run. Can be used more than once.
+//   - WithFinalizationStep(...): pass named finalization steps that receive the custom resource being deleted.
+//     Steps can report that they are in progress and their completion is recorded in the custom resource, so
+//     completed steps are not run again. Can be used more than once.
+//   - WithFinalizationDeadline(...): sets a deadline for the finalization logic to complete, after which the
+//     finalization gives up or escalates, depending on the policy.
+//
+// When a finalizer is configured, the resources owned through labels (cluster scoped resources or resources
+// in other namespaces, see resource.SetOwner) are deleted during finalization, as the kubernetes garbage
+// collector is unable to do so.
 func (r *Reconciler) ManageResourceLifecycle(ctx context.Context, req reconcile.Request, obj client.Object,
 	opts ...lifecycleOption) Result {
 
@@ -177,11 +245,17 @@ func (r *Reconciler) ManageResourceLifecycle(ctx context.Context, req reconcile.
 	for _, o := range opts {
 		o.applyToLifecycleOptions(options)
 	}
+	if len(options.errors) > 0 {
+		return Result{Error: utilerrors.NewAggregate(options.errors)}
+	}
 
 	ctx, logger := r.Logger(ctx)
 	err := r.Client.Get(ctx, types.NamespacedName{Name: req.Name, Namespace: req.Namespace}, obj)
 	if err != nil {
 		if errors.IsNotFound(err) {
+			// the resource has been deleted, so the types it used can be released
+			r.releaseTypes(ctx, r.typeTracker.releaseOwner(req.NamespacedName))
+			r.references.set(req.NamespacedName, nil)
 			// Return and don't requeue
 			return Result{Action: ReturnAction}
 		}
@@ -195,9 +269,18 @@ func (r *Reconciler) ManageResourceLifecycle(ctx context.Context, req reconcile.
 		// resource
 		if options.finalizer != nil && controllerutil.ContainsFinalizer(obj, *options.finalizer) {
 
-			err := r.finalize(ctx, options.finalizationLogic)
+			result, done := r.finalize(ctx, obj, options.finalizationLogic, options.finalizationDeadline)
+			if !done {
+				if result.Error != nil {
+					logger.Error(result.Error, "unable to delete instance")
+				}
+				return result
+			}
+			// resources owned through labels are not garbage collected
+			// by kubernetes, so they need to be deleted by the controller
+			err = r.deleteLabelOwned(ctx, obj)
 			if err != nil {
-				logger.Error(err, "unable to delete instance")
+				logger.Error(err, "unable to delete resources owned through labels")
 				return Result{Error: err}
 			}
 			controllerutil.RemoveFinalizer(obj, *options.finalizer)
@@ -266,18 +349,6 @@ func (r *Reconciler) inMemoryInitialization(ctx context.Context, obj client.Obje
 	return nil
 }
 
-// finalize contains finalization logic for the Reconciler
-func (r *Reconciler) finalize(ctx context.Context, fns []finalizationFunction) error {
-	// Call any cleanup functions passed
-	for _, fn := range fns {
-		err := fn(ctx, r.Client)
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 // ReconcileOwnedResources handles generalized resource reconcile logic for a controller:
 //
 //   - Takes a list of templates and calls resource.CreateOrUpdate on each one of them. The templates
@@ -287,35 +358,132 @@ func (r *Reconciler) finalize(ctx context.Context, fns []finalizationFunction) e
 //   - Each template is added to the list of managed resources if resource.CreateOrUpdate returns with no error
 //   - If the resource pruner is enabled any resource owned by the custom resource not present in the list of managed
 //     resources is deleted. The resource pruner must be enabled in the global config (see package config) and also not
-//     explicitly disabled in the resource by the '<annotations-domain>/prune: true/false' annotation.
-func (r *Reconciler) ReconcileOwnedResources(ctx context.Context, owner client.Object, list []resource.TemplateInterface) Result {
+//     explicitly disabled in the resource by the '<annotations-domain>/prune: true/false' annotation. The old
+//     generations of the objects built by resource.GeneratedTemplate are only pruned once they are not referenced
+//     by the managed workloads or, if enabled in the global config (see config.EnableGeneratedReferenceCheck), by
+//     any workload or pod in their namespace.
+//   - Cluster scoped resources and resources in a namespace other than the owner's are owned through labels instead
+//     of OwnerReferences (see resource.SetOwner). Both the resource pruner and the dynamic watches are aware of this.
+//     The types of these resources are recorded in the owner (see LabelOwnedTypesAnnotationKey).
+//   - The resource types in use by each owner are counted. When a type is no longer used by any owner (because
+//     the owners have stopped managing resources of that type or have been deleted) it stops being pruned and
+//     its dynamic watch is stopped (see DynamicWatchOptions.RemoveInformer).
+//   - If reference tracking is enabled in the global config (see package config), the objects read through the
+//     client while building the templates (for example the Secrets and ConfigMaps hashed by mutators.RolloutTrigger)
+//     are recorded and watched, so any change to them triggers a reconcile of the owner. Dynamic watches must
+//     also be enabled for this to work.
+//   - The global mutations configured in the Reconciler (see WithGlobalMutation) are applied to the objects built
+//     from the templates, after the mutations of each template.
+//   - If the propagation of labels and annotations is enabled in the global config (see package config), the
+//     selected labels and annotations of the owner are copied to the owned resources (see mutators.PropagateOwnerMetadata).
+//   - If rollout restarts are enabled (by passing the WithRolloutRestart option), the rollout restart annotation of the owner is
+//     copied to the pod templates of the owned Deployments, StatefulSets and DaemonSets.
+//   - The hooks of the templates (see resource.TemplateWithHooks) are called around the actions performed on the
+//     resources. The resource pruner calls the hooks of the templates that manage resources of the same type as the
+//     pruned resource, with resource.ActionPrune. If a hook delays an action (see resource.DelayError), the
+//     reconcile of the owned resources stops and the owner is requeued after the requested delay.
+func (r *Reconciler) ReconcileOwnedResources(ctx context.Context, owner client.Object, list []resource.TemplateInterface,
+	opts ...reconcileOption) Result {
+
+	options := &reconcileOptions{}
+	for _, o := range opts {
+		o.applyToReconcileOptions(options)
+	}
+	// let the mutations read the live objects bypassing the cache
+	ctx = resource.ContextWithAPIReader(ctx, r.uncachedReader())
 	managedResources := []corev1.ObjectReference{}
+	pruneHooks := map[schema.GroupVersionKind][]resource.TemplateWithHooks{}
+	for gvk, hooks := range r.pruneHooks {
+		pruneHooks[gvk] = append(pruneHooks[gvk], hooks...)
+	}
 	requeue := false
 
+	if config.AreDynamicWatchesEnabled() {
+		if _, err := r.typeTracker.controller(); err != nil {
+			return Result{Error: err}
+		}
+	}
+
+	var tc *trackingClient
+	if config.IsReferenceTrackingEnabled() {
+		tc = newTrackingClient(r.Client, r.Scheme)
+	}
+
+	mutations := r.globalTemplateMutations(owner)
+	if config.GetPropagationConfig().IsEnabled() {
+		mutations = append(mutations, mutators.PropagateOwnerMetadata(owner))
+	}
+	if domain := options.rolloutRestart; domain != nil {
+		mutations = append(mutations, mutators.RolloutRestart(owner, *domain))
+	}
+
 	for _, template := range list {
-		ref, err := resource.CreateOrUpdate(ctx, r.Client, r.Scheme, owner, template)
+		if len(mutations) > 0 {
+			template = mutatingTemplate{TemplateInterface: template, mutations: mutations}
+		}
+		if tc != nil {
+			template = trackingTemplate{TemplateInterface: template, cl: tc}
+		}
+		ref, err := resource.CreateOrUpdate(ctx, metadataOnlyClient{Client: r.Client, r: r}, r.Scheme, owner, template)
 		if err != nil {
+			if result, ok := delayedResult(ctx, err); ok {
+				return result
+			}
 			return Result{Error: fmt.Errorf("unable to CreateOrUpdate resource: %w", err)}
 		}
 		if ref != nil {
 			managedResources = append(managedResources, *ref)
 			gvk := schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind)
-			if changed := r.typeTracker.trackType(gvk); changed && config.AreDynamicWatchesEnabled() {
-				r.watchOwned(gvk, owner)
+			if t, ok := resource.TemplateAs[resource.TemplateWithHooks](template); ok {
+				pruneHooks[gvk] = append(pruneHooks[gvk], t)
+			}
+			if changed := r.typeTracker.acquireType(client.ObjectKeyFromObject(owner), gvk); changed && config.AreDynamicWatchesEnabled() {
+				if err := r.watchOwned(gvk, owner); err != nil {
+					// untrack the type so the watch registration is
+					// retried in the next reconcile
+					r.typeTracker.untrackType(gvk)
+					r.recordWatchError(owner, gvk, err)
+					return Result{Error: fmt.Errorf("unable to watch resource type %s: %w", gvk, err)}
+				}
 				// requeue so we make sure we haven't lost any events related to the owned resource
 				// while the watch was not still up
 				requeue = true
 			}
+			// the type must be acquired (and its watch registered)
+			// before it is marked as owned through labels
+			if resource.RequiresLabelOwnership(owner, ref.Namespace) {
+				r.typeTracker.trackLabelOwnedType(gvk)
+				if err := r.recordLabelOwnedType(ctx, owner, gvk); err != nil {
+					return Result{Error: err}
+				}
+			}
+		}
+	}
+
+	if tc != nil && config.AreDynamicWatchesEnabled() {
+		if err := r.trackReferences(owner, tc.references(managedResources)); err != nil {
+			return Result{Error: err}
 		}
 	}
 
 	if isPrunerEnabled(owner) {
-		if err := r.pruneOrphaned(ctx, owner, managedResources); err != nil {
+		if err := r.pruneOrphaned(ctx, owner, managedResources, pruneHooks); err != nil {
+			if result, ok := delayedResult(ctx, err); ok {
+				return result
+			}
 
 			return Result{Error: fmt.Errorf("unable to prune orphaned resources: %w", err)}
 		}
 	}
 
+	// release the types that the owner does not use anymore, after the
+	// pruner has had the chance to delete the resources of those types
+	inUse := make([]schema.GroupVersionKind, 0, len(managedResources))
+	for _, ref := range managedResources {
+		inUse = append(inUse, schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind))
+	}
+	r.releaseTypes(ctx, r.typeTracker.releaseUnusedTypes(client.ObjectKeyFromObject(owner), inUse))
+
 	if requeue {
 		return Result{Action: ReturnAndRequeueAction}
 	} else {
@@ -323,6 +491,20 @@ func (r *Reconciler) ReconcileOwnedResources(ctx context.Context, owner client.O
 	}
 }
 
+// delayedResult returns the Result that requeues the owner when the error has been
+// produced by a hook that delays an action (see resource.DelayError)
+func delayedResult(ctx context.Context, err error) (Result, bool) {
+	delay, ok := resource.AsDelayError(err)
+	if !ok {
+		return Result{}, false
+	}
+	logr.FromContextOrDiscard(ctx).Info("action delayed by hook", "reason", delay.Reason, "after", delay.After)
+	if delay.After > 0 {
+		return Result{Action: ReturnAction, RequeueAfter: delay.After}, true
+	}
+	return Result{Action: ReturnAndRequeueAction}, true
+}
+
 // FilteredEventHandler returns an EventHandler for the specific client.ObjectList
 // passed as parameter. It will produce reconcile requests for any client.Object of the
 // given type that returns true when passed to the filter function. If the filter function
@@ -330,6 +512,8 @@ func (r *Reconciler) ReconcileOwnedResources(ctx context.Context, owner client.O
 // The filter function receives both the object that generated the event and the object that
 // might need to be reconciled in response to that event. Depending on whether it returns true
 // or false the reconciler request will be generated or not.
+// For large numbers of objects consider using IndexedEventHandler instead, as this
+// handler lists all the objects of the given type for each event.
 //
 // In the following example, a watch for Secret resources which match the name "secret" is added
 // to the reconciler. The watch will generate reconmcile requests for v1alpha1.Test resources
@@ -5,20 +5,27 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/3scale-ops/basereconciler/config"
 	"github.com/3scale-ops/basereconciler/resource"
 	"github.com/3scale-ops/basereconciler/util"
 	"github.com/go-logr/logr"
 	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
@@ -403,9 +410,15 @@ func TestReconciler_ManageResourceLifecycle(t *testing.T) {
 
 type testController struct {
 	reconcile.Reconciler
+	watchErr error
+	watches  []source.Source
 }
 
 func (c *testController) Watch(src source.Source) error {
+	if c.watchErr != nil {
+		return c.watchErr
+	}
+	c.watches = append(c.watches, src)
 	return nil
 }
 func (c *testController) Start(ctx context.Context) error { return nil }
@@ -499,11 +512,11 @@ func TestReconciler_ReconcileOwnedResources(t *testing.T) {
 			r := &Reconciler{
 				Client: tt.fields.Client,
 				Scheme: tt.fields.Scheme,
-				typeTracker: typeTracker{
-					seenTypes: tt.fields.SeenTypes,
-					ctrl:      &testController{},
-				},
-				mgr: tt.fields.mgr,
+				mgr:    tt.fields.mgr,
+			}
+			r.BuildTypeTracker(&testController{})
+			for _, gvk := range tt.fields.SeenTypes {
+				r.typeTracker.trackType(gvk)
 			}
 			got := r.ReconcileOwnedResources(context.TODO(), tt.args.owner, tt.args.list)
 			if diff := cmp.Diff(got, tt.want); len(diff) > 0 {
@@ -513,3 +526,191 @@ func TestReconciler_ReconcileOwnedResources(t *testing.T) {
 		})
 	}
 }
+
+func TestReconciler_ReconcileOwnedResources_labelOwned(t *testing.T) {
+	mgr, _ := ctrl.NewManager(&rest.Config{}, ctrl.Options{})
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"}}
+	r := &Reconciler{
+		Client: fake.NewClientBuilder().WithObjects(owner.DeepCopy()).Build(),
+		Scheme: scheme.Scheme,
+		mgr:    mgr,
+	}
+	c := &testController{}
+	r.BuildTypeTracker(c)
+	gvk := schema.FromAPIVersionAndKind("rbac.authorization.k8s.io/v1", "ClusterRole")
+
+	got := r.ReconcileOwnedResources(context.TODO(), owner, []resource.TemplateInterface{
+		resource.NewTemplateFromObjectFunction[*rbacv1.ClusterRole](
+			func() *rbacv1.ClusterRole {
+				return &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cr"}}
+			}),
+	})
+
+	if diff := cmp.Diff(got, Result{Action: ReturnAndRequeueAction}); len(diff) > 0 {
+		t.Errorf("Reconciler.ReconcileOwnedResources() diff = %v", diff)
+	}
+	if len(c.watches) != 1 {
+		t.Errorf("Reconciler.ReconcileOwnedResources() registered %d watches, want 1", len(c.watches))
+	}
+	if !r.typeTracker.isLabelOwnedType(gvk) {
+		t.Errorf("Reconciler.ReconcileOwnedResources() expected %s to be label owned", gvk)
+	}
+	if released := r.typeTracker.releaseOwner(client.ObjectKeyFromObject(owner)); len(released) != 1 || released[0].source == nil {
+		t.Errorf("Reconciler.ReconcileOwnedResources() expected %s to be acquired by the owner with a watch", gvk)
+	}
+}
+
+func TestReconciler_ReconcileOwnedResources_withoutController(t *testing.T) {
+	r := &Reconciler{
+		Client: fake.NewClientBuilder().Build(),
+		Scheme: scheme.Scheme,
+	}
+	got := r.ReconcileOwnedResources(context.TODO(),
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+		[]resource.TemplateInterface{
+			resource.NewTemplateFromObjectFunction[*corev1.ConfigMap](
+				func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+				}),
+		})
+	if !errors.Is(got.Error, errNoController) {
+		t.Errorf("Reconciler.ReconcileOwnedResources() error = %v, want %v", got.Error, errNoController)
+	}
+}
+
+func TestReconciler_ReconcileOwnedResources_watchError(t *testing.T) {
+	mgr, _ := ctrl.NewManager(&rest.Config{}, ctrl.Options{})
+	recorder := record.NewFakeRecorder(10)
+	r := &Reconciler{
+		Client:   fake.NewClientBuilder().Build(),
+		Scheme:   scheme.Scheme,
+		mgr:      mgr,
+		recorder: recorder,
+	}
+	r.BuildTypeTracker(&testController{watchErr: errors.New("watch error")})
+	gvk := schema.GroupVersionKind{Group: "", Version: "v1", Kind: "ConfigMap"}
+	before := counterValue(t, dynamicWatchErrors.WithLabelValues(gvk.Group, gvk.Version, gvk.Kind))
+
+	got := r.ReconcileOwnedResources(context.TODO(),
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+		[]resource.TemplateInterface{
+			resource.NewTemplateFromObjectFunction[*corev1.ConfigMap](
+				func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+				}),
+		})
+
+	if got.Error == nil {
+		t.Errorf("Reconciler.ReconcileOwnedResources() expected an error")
+	}
+	if len(r.typeTracker.seenTypes()) != 0 {
+		t.Errorf("Reconciler.ReconcileOwnedResources() expected %s to be untracked", gvk)
+	}
+	if after := counterValue(t, dynamicWatchErrors.WithLabelValues(gvk.Group, gvk.Version, gvk.Kind)); after != before+1 {
+		t.Errorf("Reconciler.ReconcileOwnedResources() metric = %v, want %v", after, before+1)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.HasPrefix(event, "Warning WatchFailed") {
+			t.Errorf("Reconciler.ReconcileOwnedResources() event = %s", event)
+		}
+	default:
+		t.Errorf("Reconciler.ReconcileOwnedResources() expected an event")
+	}
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	m := &dto.Metric{}
+	if err := c.Write(m); err != nil {
+		t.Fatalf("unable to read metric: %v", err)
+	}
+	return m.GetCounter().GetValue()
+}
+
+func TestReconciler_ReconcileOwnedResources_rolloutRestart(t *testing.T) {
+	mgr, _ := ctrl.NewManager(&rest.Config{}, ctrl.Options{})
+	cl := fake.NewClientBuilder().Build()
+	r := &Reconciler{
+		Client: cl,
+		Scheme: scheme.Scheme,
+		mgr:    mgr,
+	}
+	r.BuildTypeTracker(&testController{})
+
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns",
+		Annotations: map[string]string{"example.com/restartedAt": "2024-01-01T00:00:00Z"}}}
+	got := r.ReconcileOwnedResources(context.TODO(), owner, []resource.TemplateInterface{
+		resource.NewTemplateFromObjectFunction[*appsv1.Deployment](
+			func() *appsv1.Deployment {
+				return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "deployment", Namespace: "ns"}}
+			}),
+	}, WithRolloutRestart("example.com"))
+	if got.Error != nil {
+		t.Fatalf("Reconciler.ReconcileOwnedResources() error = %v", got.Error)
+	}
+
+	dep := &appsv1.Deployment{}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "deployment", Namespace: "ns"}, dep); err != nil {
+		t.Fatalf("unable to get deployment: %v", err)
+	}
+	if v := dep.Spec.Template.GetAnnotations()["example.com/restartedAt"]; v != "2024-01-01T00:00:00Z" {
+		t.Errorf("Reconciler.ReconcileOwnedResources() restart annotation = %q", v)
+	}
+}
+
+func TestReconciler_ReconcileOwnedResources_propagation(t *testing.T) {
+	defer config.SetPropagationConfig(config.GetPropagationConfig())
+	config.SetPropagationConfig(config.PropagationConfig{LabelPrefixes: []string{"cost.example.com/"}})
+
+	mgr, _ := ctrl.NewManager(&rest.Config{}, ctrl.Options{})
+	cl := fake.NewClientBuilder().Build()
+	r := &Reconciler{Client: cl, Scheme: scheme.Scheme, mgr: mgr}
+	r.BuildTypeTracker(&testController{})
+	templates := []resource.TemplateInterface{
+		resource.NewTemplateFromObjectFunction[*corev1.ConfigMap](
+			func() *corev1.ConfigMap {
+				return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+			}),
+	}
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns",
+		Labels: map[string]string{"cost.example.com/center": "1", "other": "x"}}}
+
+	for _, want := range []map[string]string{{"cost.example.com/center": "1"}, nil} {
+		if got := r.ReconcileOwnedResources(context.TODO(), owner, templates); got.Error != nil {
+			t.Fatalf("Reconciler.ReconcileOwnedResources() error = %v", got.Error)
+		}
+		cm := &corev1.ConfigMap{}
+		if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cm", Namespace: "ns"}, cm); err != nil {
+			t.Fatalf("unable to get configmap: %v", err)
+		}
+		if diff := cmp.Diff(cm.GetLabels(), want); len(diff) > 0 {
+			t.Errorf("Reconciler.ReconcileOwnedResources() labels diff = %v", diff)
+		}
+		// remove the label from the owner
+		owner.SetLabels(map[string]string{"other": "x"})
+	}
+}
+
+func TestReconciler_ReconcileOwnedResources_delayedByHook(t *testing.T) {
+	mgr, _ := ctrl.NewManager(&rest.Config{}, ctrl.Options{})
+	cl := fake.NewClientBuilder().Build()
+	r := &Reconciler{Client: cl, Scheme: scheme.Scheme, mgr: mgr}
+	r.BuildTypeTracker(&testController{})
+
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}}
+	got := r.ReconcileOwnedResources(context.TODO(), owner, []resource.TemplateInterface{
+		resource.NewTemplateFromObjectFunction[*corev1.ConfigMap](
+			func() *corev1.ConfigMap {
+				return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+			}).
+			WithPreHook(func(context.Context, client.Client, resource.Action, client.Object, client.Object) error {
+				return resource.Delay(time.Minute, "waiting for cache flush")
+			}),
+	})
+	if diff := cmp.Diff(got, Result{Action: ReturnAction, RequeueAfter: time.Minute}); len(diff) > 0 {
+		t.Errorf("Reconciler.ReconcileOwnedResources() diff = %v", diff)
+	}
+	if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cm", Namespace: "ns"}, &corev1.ConfigMap{}); err == nil {
+		t.Errorf("Reconciler.ReconcileOwnedResources() expected configmap not to be created")
+	}
+}
@@ -0,0 +1,224 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// referenceKey identifies an object referenced by an owner
+type referenceKey struct {
+	gvk schema.GroupVersionKind
+	key client.ObjectKey
+}
+
+// trackingClient is a client.Client that records the objects read
+// through it with Get, including the ones that are not found
+type trackingClient struct {
+	client.Client
+	scheme *runtime.Scheme
+	mu     sync.Mutex
+	reads  map[referenceKey]struct{}
+}
+
+func newTrackingClient(cl client.Client, scheme *runtime.Scheme) *trackingClient {
+	return &trackingClient{Client: cl, scheme: scheme, reads: map[referenceKey]struct{}{}}
+}
+
+// Get implements client.Reader
+func (c *trackingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	err := c.Client.Get(ctx, key, obj, opts...)
+	if err == nil || errors.IsNotFound(err) {
+		if gvk, gvkErr := apiutil.GVKForObject(obj, c.scheme); gvkErr == nil {
+			c.mu.Lock()
+			c.reads[referenceKey{gvk: gvk, key: key}] = struct{}{}
+			c.mu.Unlock()
+		}
+	}
+	return err
+}
+
+// references returns the objects read through the client,
+// excluding the managed ones
+func (c *trackingClient) references(managed []corev1.ObjectReference) []referenceKey {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	refs := make([]referenceKey, 0, len(c.reads))
+	for ref := range c.reads {
+		isManaged := false
+		for _, m := range managed {
+			if schema.FromAPIVersionAndKind(m.APIVersion, m.Kind) == ref.gvk &&
+				m.Name == ref.key.Name && m.Namespace == ref.key.Namespace {
+				isManaged = true
+				break
+			}
+		}
+		if !isManaged {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].gvk != refs[j].gvk {
+			return refs[i].gvk.String() < refs[j].gvk.String()
+		}
+		return refs[i].key.String() < refs[j].key.String()
+	})
+	return refs
+}
+
+// trackingTemplate is a TemplateInterface that builds the wrapped
+// template using a trackingClient
+type trackingTemplate struct {
+	resource.TemplateInterface
+	cl *trackingClient
+}
+
+// Unwrap returns the wrapped template, so the optional interfaces
+// it implements are still available to resource.CreateOrUpdate
+func (t trackingTemplate) Unwrap() resource.TemplateInterface {
+	return t.TemplateInterface
+}
+
+// Build implements resource.TemplateInterface
+func (t trackingTemplate) Build(ctx context.Context, _ client.Client, o client.Object) (client.Object, error) {
+	return t.TemplateInterface.Build(ctx, t.cl, o)
+}
+
+// referenceTracker keeps track of the objects referenced by each owner and
+// of the types of referenced objects that are being watched
+type referenceTracker struct {
+	mu sync.Mutex
+	// byOwner holds the objects referenced by each owner
+	byOwner map[client.ObjectKey][]referenceKey
+	// owners holds the owners that reference each object
+	owners map[referenceKey]map[client.ObjectKey]struct{}
+	// watched holds the types of referenced objects that are watched
+	watched map[schema.GroupVersionKind]struct{}
+}
+
+// set replaces the list of objects referenced by the owner
+func (rt *referenceTracker) set(owner client.ObjectKey, refs []referenceKey) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.owners == nil {
+		rt.byOwner = map[client.ObjectKey][]referenceKey{}
+		rt.owners = map[referenceKey]map[client.ObjectKey]struct{}{}
+	}
+	for _, ref := range rt.byOwner[owner] {
+		delete(rt.owners[ref], owner)
+		if len(rt.owners[ref]) == 0 {
+			delete(rt.owners, ref)
+		}
+	}
+	if len(refs) == 0 {
+		delete(rt.byOwner, owner)
+		return
+	}
+	rt.byOwner[owner] = refs
+	for _, ref := range refs {
+		if rt.owners[ref] == nil {
+			rt.owners[ref] = map[client.ObjectKey]struct{}{}
+		}
+		rt.owners[ref][owner] = struct{}{}
+	}
+}
+
+// ownersOf returns the owners that reference the object, sorted
+func (rt *referenceTracker) ownersOf(ref referenceKey) []client.ObjectKey {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	owners := make([]client.ObjectKey, 0, len(rt.owners[ref]))
+	for owner := range rt.owners[ref] {
+		owners = append(owners, owner)
+	}
+	sort.Slice(owners, func(i, j int) bool { return owners[i].String() < owners[j].String() })
+	return owners
+}
+
+// watchType marks the type as watched. It returns true only
+// for the call that actually marks the type.
+func (rt *referenceTracker) watchType(gvk schema.GroupVersionKind) bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	if rt.watched == nil {
+		rt.watched = map[schema.GroupVersionKind]struct{}{}
+	}
+	if _, ok := rt.watched[gvk]; ok {
+		return false
+	}
+	rt.watched[gvk] = struct{}{}
+	return true
+}
+
+// unwatchType removes the watched mark from the type
+func (rt *referenceTracker) unwatchType(gvk schema.GroupVersionKind) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	delete(rt.watched, gvk)
+}
+
+// trackReferences records the objects referenced by the owner and ensures
+// there is a watch for each type of referenced object
+func (r *Reconciler) trackReferences(owner client.Object, refs []referenceKey) error {
+	r.references.set(client.ObjectKeyFromObject(owner), refs)
+	for _, ref := range refs {
+		if !r.references.watchType(ref.gvk) {
+			continue
+		}
+		if err := r.watchReferenced(ref.gvk); err != nil {
+			// unmark the type so the watch registration is
+			// retried in the next reconcile
+			r.references.unwatchType(ref.gvk)
+			r.recordWatchError(owner, ref.gvk, err)
+			return fmt.Errorf("unable to watch referenced resource type %s: %w", ref.gvk, err)
+		}
+	}
+	return nil
+}
+
+// watchReferenced adds a watch for referenced objects of the given type. The
+// events are mapped to the owners that reference the object.
+func (r *Reconciler) watchReferenced(gvk schema.GroupVersionKind) error {
+	ctrl, err := r.typeTracker.controller()
+	if err != nil {
+		return err
+	}
+	o, err := r.newWatchedObject(gvk)
+	if err != nil {
+		return err
+	}
+	return ctrl.Watch(&dynamicSource{
+		cache:   r.mgr.GetCache(),
+		obj:     o,
+		handler: r.enqueueRequestForReferencing(gvk),
+		// the informer is never removed, as it is also used
+		// by the client to read the referenced objects
+		users: &r.informers,
+	})
+}
+
+// enqueueRequestForReferencing returns an EventHandler that produces reconcile requests
+// for the owners that reference the object of the given type that generated the event
+func (r *Reconciler) enqueueRequestForReferencing(gvk schema.GroupVersionKind) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(
+		func(ctx context.Context, o client.Object) []reconcile.Request {
+			owners := r.references.ownersOf(referenceKey{gvk: gvk, key: client.ObjectKeyFromObject(o)})
+			req := make([]reconcile.Request, 0, len(owners))
+			for _, owner := range owners {
+				req = append(req, reconcile.Request{NamespacedName: owner})
+			}
+			return req
+		},
+	)
+}
@@ -0,0 +1,87 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconciler_ReconcileOwnedResources_referenceTracking(t *testing.T) {
+	config.EnableReferenceTracking()
+	defer config.DisableReferenceTracking()
+
+	mgr, _ := ctrl.NewManager(&rest.Config{}, ctrl.Options{})
+	r := &Reconciler{
+		Client: fake.NewClientBuilder().WithObjects(
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}},
+		).Build(),
+		Scheme: scheme.Scheme,
+		mgr:    mgr,
+	}
+	r.BuildTypeTracker(&testController{})
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}}
+
+	got := r.ReconcileOwnedResources(context.TODO(), owner, []resource.TemplateInterface{
+		resource.NewTemplateFromObjectFunction[*corev1.ConfigMap](
+			func() *corev1.ConfigMap {
+				return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+			}).
+			WithMutation(func(ctx context.Context, cl client.Client, desired client.Object) error {
+				// reads of the managed object itself are not references
+				if err := cl.Get(ctx, client.ObjectKeyFromObject(desired), &corev1.ConfigMap{}); client.IgnoreNotFound(err) != nil {
+					return err
+				}
+				if err := cl.Get(ctx, types.NamespacedName{Name: "missing", Namespace: "ns"}, &corev1.ConfigMap{}); client.IgnoreNotFound(err) != nil {
+					return err
+				}
+				return cl.Get(ctx, types.NamespacedName{Name: "secret", Namespace: "ns"}, &corev1.Secret{})
+			}),
+	})
+	if got.Error != nil {
+		t.Fatalf("Reconciler.ReconcileOwnedResources() error = %v", got.Error)
+	}
+
+	want := []referenceKey{
+		{gvk: schema.FromAPIVersionAndKind("v1", "ConfigMap"), key: types.NamespacedName{Name: "missing", Namespace: "ns"}},
+		{gvk: schema.FromAPIVersionAndKind("v1", "Secret"), key: types.NamespacedName{Name: "secret", Namespace: "ns"}},
+	}
+	if diff := cmp.Diff(r.references.byOwner[client.ObjectKeyFromObject(owner)], want, cmp.AllowUnexported(referenceKey{})); len(diff) > 0 {
+		t.Errorf("Reconciler.ReconcileOwnedResources() references diff = %v", diff)
+	}
+
+	q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer q.ShutDown()
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}}
+	r.enqueueRequestForReferencing(schema.FromAPIVersionAndKind("v1", "Secret")).
+		Update(context.TODO(), event.UpdateEvent{ObjectOld: secret, ObjectNew: secret}, q)
+	if q.Len() != 1 {
+		t.Fatalf("enqueueRequestForReferencing() got %d requests, want 1", q.Len())
+	}
+	if item, _ := q.Get(); item.NamespacedName != client.ObjectKeyFromObject(owner) {
+		t.Errorf("enqueueRequestForReferencing() got %v, want %v", item, client.ObjectKeyFromObject(owner))
+	}
+
+	// references are released when the owner is deleted
+	result := r.ManageResourceLifecycle(context.TODO(), reconcile.Request{NamespacedName: client.ObjectKeyFromObject(owner)}, &corev1.ServiceAccount{})
+	if result.Action != ReturnAction {
+		t.Errorf("Reconciler.ManageResourceLifecycle() = %v, want %v", result.Action, ReturnAction)
+	}
+	if owners := r.references.ownersOf(want[1]); len(owners) != 0 {
+		t.Errorf("referenceTracker.ownersOf() = %v, want none", owners)
+	}
+}
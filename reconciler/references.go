@@ -0,0 +1,118 @@
+package reconciler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/3scale-ops/basereconciler/util"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ReferencesIndexField is the name of the cache field index that
+// holds the objects referenced by a custom resource (see IndexReferences)
+const ReferencesIndexField = "basereconciler.references"
+
+// ObjectWithReferences is an interface that implements
+// client.Object and declares the objects (Secrets, ConfigMaps, ...)
+// referenced by the custom resource
+type ObjectWithReferences interface {
+	client.Object
+	// GetReferences returns the objects referenced by the custom resource. The
+	// APIVersion, Kind and Name of each reference are required. If the Namespace
+	// is empty, the namespace of the custom resource is assumed.
+	GetReferences() []corev1.ObjectReference
+}
+
+// ReferenceIndexKey returns the key used in the references index for an object
+// of the given GroupKind, in "Kind.group/namespace/name" format
+func ReferenceIndexKey(gk schema.GroupKind, key types.NamespacedName) string {
+	return fmt.Sprintf("%s/%s/%s", gk.String(), key.Namespace, key.Name)
+}
+
+// IndexReferences adds a field index to the cache for the given custom resource type, so
+// the custom resources can be looked up by the objects they reference. It is required by
+// IndexedEventHandler and must be called before the manager is started, typically within
+// the "SetupWithManager" function:
+//
+//	if err := reconciler.IndexReferences(ctx, mgr.GetFieldIndexer(), &v1alpha1.Test{}); err != nil {
+//		return err
+//	}
+func IndexReferences(ctx context.Context, indexer client.FieldIndexer, obj ObjectWithReferences) error {
+	return indexer.IndexField(ctx, obj, ReferencesIndexField, referencesIndexer)
+}
+
+func referencesIndexer(o client.Object) []string {
+	obj, ok := o.(ObjectWithReferences)
+	if !ok {
+		return nil
+	}
+	refs := obj.GetReferences()
+	keys := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err != nil {
+			continue
+		}
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = obj.GetNamespace()
+		}
+		keys = append(keys, ReferenceIndexKey(gv.WithKind(ref.Kind).GroupKind(),
+			types.NamespacedName{Name: ref.Name, Namespace: namespace}))
+	}
+	return keys
+}
+
+// IndexedEventHandler returns an EventHandler for the specific client.ObjectList
+// passed as parameter. It will produce reconcile requests for the objects of the given
+// type that reference the object that generated the event (see ObjectWithReferences).
+// Unlike FilteredEventHandler, which lists all the objects of the given type for each
+// event, the objects are looked up in the references index, which must have been added
+// to the cache with IndexReferences.
+//
+// In the following example, a watch for Secret resources is added to the reconciler. The
+// watch will generate reconcile requests for the v1alpha1.Test resources that reference the
+// Secret any time it is created/updated/deleted
+//
+//	func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+//		if err := reconciler.IndexReferences(context.Background(), mgr.GetFieldIndexer(), &v1alpha1.Test{}); err != nil {
+//			return err
+//		}
+//		return ctrl.NewControllerManagedBy(mgr).
+//			For(&v1alpha1.Test{}).
+//			Watches(&corev1.Secret{}, r.IndexedEventHandler(&v1alpha1.TestList{}, r.Log)).
+//			Complete(r)
+//	}
+func (r *Reconciler) IndexedEventHandler(ol client.ObjectList, logger logr.Logger) handler.EventHandler {
+
+	return handler.EnqueueRequestsFromMapFunc(
+		func(ctx context.Context, event client.Object) []reconcile.Request {
+			gvk, err := apiutil.GVKForObject(event, r.Scheme)
+			if err != nil {
+				logger.Error(err, "unable to get GVK for object")
+				return []reconcile.Request{}
+			}
+			list := ol.DeepCopyObject().(client.ObjectList)
+			err = r.Client.List(ctx, list, client.MatchingFields{
+				ReferencesIndexField: ReferenceIndexKey(gvk.GroupKind(), client.ObjectKeyFromObject(event)),
+			})
+			if err != nil {
+				logger.Error(err, "unable to retrieve the list of resources")
+				return []reconcile.Request{}
+			}
+			items := util.GetItems(list)
+			req := make([]reconcile.Request, 0, len(items))
+			for _, item := range items {
+				req = append(req, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(item)})
+			}
+			return req
+		},
+	)
+}
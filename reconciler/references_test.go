@@ -0,0 +1,105 @@
+package reconciler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type testObjectWithReferences struct {
+	*corev1.ConfigMap
+	refs []corev1.ObjectReference
+}
+
+func (o testObjectWithReferences) GetReferences() []corev1.ObjectReference { return o.refs }
+
+func Test_referencesIndexer(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  client.Object
+		want []string
+	}{
+		{
+			name: "Returns the keys of the references",
+			obj: testObjectWithReferences{
+				ConfigMap: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				refs: []corev1.ObjectReference{
+					{APIVersion: "v1", Kind: "Secret", Name: "secret"},
+					{APIVersion: "v1", Kind: "ConfigMap", Name: "cm", Namespace: "other"},
+					{APIVersion: "apps/v1", Kind: "Deployment", Name: "deploy"},
+				},
+			},
+			want: []string{
+				"Secret/ns/secret",
+				"ConfigMap/other/cm",
+				"Deployment.apps/ns/deploy",
+			},
+		},
+		{
+			name: "Ignores objects without references",
+			obj:  &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(referencesIndexer(tt.obj), tt.want); len(diff) > 0 {
+				t.Errorf("referencesIndexer() diff = %v", diff)
+			}
+		})
+	}
+}
+
+func TestReconciler_IndexedEventHandler(t *testing.T) {
+	// ConfigMaps are used as the referencing objects, with
+	// the references stored in an annotation
+	cl := fake.NewClientBuilder().WithScheme(scheme.Scheme).
+		WithObjects(
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "ns",
+				Annotations: map[string]string{"ref": "secret"}}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "ns",
+				Annotations: map[string]string{"ref": "other"}}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "c", Namespace: "ns",
+				Annotations: map[string]string{"ref": "secret"}}},
+		).
+		WithIndex(&corev1.ConfigMap{}, ReferencesIndexField, func(o client.Object) []string {
+			return []string{ReferenceIndexKey(schema.GroupKind{Kind: "Secret"},
+				types.NamespacedName{Name: o.GetAnnotations()["ref"], Namespace: o.GetNamespace()})}
+		}).
+		Build()
+	r := &Reconciler{Client: cl, Scheme: scheme.Scheme}
+
+	q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer q.ShutDown()
+	h := r.IndexedEventHandler(&corev1.ConfigMapList{}, logr.Discard())
+	h.Update(context.TODO(), event.UpdateEvent{
+		ObjectOld: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}},
+		ObjectNew: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}},
+	}, q)
+
+	got := []reconcile.Request{}
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		got = append(got, item)
+		q.Done(item)
+	}
+	want := []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Name: "a", Namespace: "ns"}},
+		{NamespacedName: types.NamespacedName{Name: "c", Namespace: "ns"}},
+	}
+	if diff := cmp.Diff(got, want); len(diff) > 0 {
+		t.Errorf("Reconciler.IndexedEventHandler() diff = %v", diff)
+	}
+}
@@ -1,17 +1,20 @@
 package reconciler
 
 import (
-	"reflect"
+	"context"
+	"errors"
+	"sort"
 	"sync"
+	"sync/atomic"
 
 	"github.com/3scale-ops/basereconciler/util"
+	"github.com/go-logr/logr"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
-	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 // ReconcilerWithTypeTracker is a reconciler with a TypeTracker
@@ -43,46 +46,295 @@ func SetupWithDynamicTypeWatches(r ReconcilerWithTypeTracker, bldr *builder.Buil
 	return nil
 }
 
+// typeTracker keeps track of the resource types owned by the controller. The set of
+// tracked types is copy-on-write: readers load the current set without locking while
+// writers, serialized by the mutex, replace it with a modified copy. This allows for
+// concurrent reconciles (MaxConcurrentReconciles > 1) to safely share the tracker.
+// The zero value is ready to use.
+//
+// The tracker also counts the owners that use each type (see acquireType). Types that
+// are no longer in use by any owner are released: they stop being pruned and their
+// dynamic watch is stopped.
 type typeTracker struct {
-	seenTypes []schema.GroupVersionKind
-	ctrl      controller.Controller
-	mu        sync.Mutex
+	types atomic.Pointer[typeSet]
+	ctrl  controller.Controller
+	mu    sync.Mutex
+	// owners holds the types in use by each owner, refs the
+	// number of owners using each type and watches the sources of the
+	// dynamic watches. They are protected by the mutex.
+	owners  map[client.ObjectKey]map[schema.GroupVersionKind]struct{}
+	refs    map[schema.GroupVersionKind]int
+	watches map[schema.GroupVersionKind]*dynamicSource
+}
+
+// typeSet is the set of tracked types. A typeSet is never modified
+// once it has been stored in the typeTracker.
+type typeSet map[schema.GroupVersionKind]typeInfo
+
+type typeInfo struct {
+	// labelOwned is true when at least one resource of this type
+	// owned through labels has been seen (see resource.SetOwner)
+	labelOwned bool
+}
+
+// load returns the current set of tracked types. The returned
+// set must not be modified.
+func (tt *typeTracker) load() typeSet {
+	if set := tt.types.Load(); set != nil {
+		return *set
+	}
+	return typeSet{}
+}
+
+// update applies fn to a copy of the current set of tracked types and stores it. It returns
+// whether fn modified the set. The mutex guarantees that concurrent updates are not lost.
+func (tt *typeTracker) update(fn func(typeSet) bool) bool {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	return tt.updateLocked(fn)
 }
 
+// updateLocked is like update but expects the mutex to be held by the caller
+func (tt *typeTracker) updateLocked(fn func(typeSet) bool) bool {
+	current := tt.load()
+	set := make(typeSet, len(current)+1)
+	for gvk, info := range current {
+		set[gvk] = info
+	}
+	if !fn(set) {
+		return false
+	}
+	tt.types.Store(&set)
+	return true
+}
+
+// trackType adds the type to the tracker. It returns true only for the
+// call that actually adds the type, even if there are concurrent calls.
 func (tt *typeTracker) trackType(gvk schema.GroupVersionKind) bool {
-	if !util.ContainsBy(tt.seenTypes, func(x schema.GroupVersionKind) bool {
-		return reflect.DeepEqual(x, gvk)
-	}) {
-		tt.mu.Lock()
-		defer tt.mu.Unlock()
-		tt.seenTypes = append(tt.seenTypes, gvk)
+	if _, ok := tt.load()[gvk]; ok {
+		return false
+	}
+	return tt.update(func(set typeSet) bool {
+		if _, ok := set[gvk]; ok {
+			return false
+		}
+		set[gvk] = typeInfo{}
+		return true
+	})
+}
+
+// untrackType removes the type from the tracker
+func (tt *typeTracker) untrackType(gvk schema.GroupVersionKind) bool {
+	if _, ok := tt.load()[gvk]; !ok {
+		return false
+	}
+	return tt.update(func(set typeSet) bool {
+		if _, ok := set[gvk]; !ok {
+			return false
+		}
+		delete(set, gvk)
+		return true
+	})
+}
+
+// acquireType records that the type is in use by the owner, adding it to the tracker
+// if required. Like trackType, it returns true only for the call that actually adds the type.
+func (tt *typeTracker) acquireType(owner client.ObjectKey, gvk schema.GroupVersionKind) bool {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	if tt.owners == nil {
+		tt.owners = map[client.ObjectKey]map[schema.GroupVersionKind]struct{}{}
+		tt.refs = map[schema.GroupVersionKind]int{}
+	}
+	if tt.owners[owner] == nil {
+		tt.owners[owner] = map[schema.GroupVersionKind]struct{}{}
+	}
+	if _, ok := tt.owners[owner][gvk]; !ok {
+		tt.owners[owner][gvk] = struct{}{}
+		tt.refs[gvk]++
+	}
+	return tt.updateLocked(func(set typeSet) bool {
+		if _, ok := set[gvk]; ok {
+			return false
+		}
+		set[gvk] = typeInfo{}
+		return true
+	})
+}
+
+// releasedType is a type that is no longer in use by any owner, along
+// with the source of its dynamic watch, if any
+type releasedType struct {
+	gvk    schema.GroupVersionKind
+	source *dynamicSource
+}
+
+// releaseUnusedTypes records that the owner only uses the types in the inUse list. The
+// types that are no longer in use by any owner are removed from the tracker and returned
+// so their watches can be stopped.
+func (tt *typeTracker) releaseUnusedTypes(owner client.ObjectKey, inUse []schema.GroupVersionKind) []releasedType {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+
+	released := []releasedType{}
+	for gvk := range tt.owners[owner] {
+		if util.ContainsBy(inUse, func(x schema.GroupVersionKind) bool { return x == gvk }) {
+			continue
+		}
+		delete(tt.owners[owner], gvk)
+		if tt.refs[gvk]--; tt.refs[gvk] > 0 {
+			continue
+		}
+		delete(tt.refs, gvk)
+		released = append(released, releasedType{gvk: gvk, source: tt.watches[gvk]})
+		delete(tt.watches, gvk)
+	}
+	if len(tt.owners[owner]) == 0 {
+		delete(tt.owners, owner)
+	}
+
+	if len(released) > 0 {
+		tt.updateLocked(func(set typeSet) bool {
+			for _, t := range released {
+				delete(set, t.gvk)
+			}
+			return true
+		})
+	}
+	sort.Slice(released, func(i, j int) bool { return released[i].gvk.String() < released[j].gvk.String() })
+	return released
+}
+
+// releaseOwner records that the owner does not use any type anymore,
+// typically because it has been deleted (see releaseUnusedTypes)
+func (tt *typeTracker) releaseOwner(owner client.ObjectKey) []releasedType {
+	return tt.releaseUnusedTypes(owner, nil)
+}
+
+// setWatch stores the source of the dynamic watch for the type
+func (tt *typeTracker) setWatch(gvk schema.GroupVersionKind, src *dynamicSource) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	if tt.watches == nil {
+		tt.watches = map[schema.GroupVersionKind]*dynamicSource{}
+	}
+	tt.watches[gvk] = src
+}
+
+// trackLabelOwnedType marks the type as having resources owned through labels,
+// adding it to the tracker if required. Note that acquireType does not register
+// the owner of a type already added by this function, so acquireType needs to be
+// called first.
+func (tt *typeTracker) trackLabelOwnedType(gvk schema.GroupVersionKind) bool {
+	if info, ok := tt.load()[gvk]; ok && info.labelOwned {
+		return false
+	}
+	return tt.update(func(set typeSet) bool {
+		if info, ok := set[gvk]; ok && info.labelOwned {
+			return false
+		}
+		info := set[gvk]
+		info.labelOwned = true
+		set[gvk] = info
 		return true
+	})
+}
+
+func (tt *typeTracker) isLabelOwnedType(gvk schema.GroupVersionKind) bool {
+	return tt.load()[gvk].labelOwned
+}
+
+// seenTypes returns the list of tracked types, sorted
+func (tt *typeTracker) seenTypes() []schema.GroupVersionKind {
+	return tt.list(func(typeInfo) bool { return true })
+}
+
+// labelOwnedTypes returns the list of tracked types that have
+// resources owned through labels, sorted
+func (tt *typeTracker) labelOwnedTypes() []schema.GroupVersionKind {
+	return tt.list(func(info typeInfo) bool { return info.labelOwned })
+}
+
+func (tt *typeTracker) list(filter func(typeInfo) bool) []schema.GroupVersionKind {
+	set := tt.load()
+	list := make([]schema.GroupVersionKind, 0, len(set))
+	for gvk, info := range set {
+		if filter(info) {
+			list = append(list, gvk)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].String() < list[j].String() })
+	return list
+}
+
+// controller returns the controller used to add
+// watches dynamically, if any
+func (tt *typeTracker) controller() (controller.Controller, error) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	if tt.ctrl == nil {
+		return nil, errNoController
 	}
-	return false
+	return tt.ctrl, nil
 }
 
+// errNoController is returned when dynamic watches are enabled but the reconciler
+// has not been configured with a controller
+var errNoController = errors.New("dynamic watches are enabled but the reconciler has no controller, " +
+	"use SetupWithDynamicTypeWatches to build the controller or disable dynamic watches in the global config")
+
 func (r *Reconciler) watchOwned(gvk schema.GroupVersionKind, owner client.Object) error {
-	o, err := util.NewObjectFromGVK(gvk, r.Scheme)
+	ctrl, err := r.typeTracker.controller()
 	if err != nil {
 		return err
 	}
-	r.typeTracker.mu.Lock()
-	defer r.typeTracker.mu.Unlock()
-	err = r.typeTracker.ctrl.Watch(source.Kind(
-		r.mgr.GetCache(), o,
+	o, err := r.newWatchedObject(gvk)
+	if err != nil {
+		return err
+	}
+	opts := r.dynamicWatchOptions(gvk)
+	var h handler.EventHandler = eventHandlers{
 		handler.EnqueueRequestForOwner(r.mgr.GetScheme(), r.mgr.GetRESTMapper(), owner, handler.OnlyControllerOwner()),
-	))
+		EnqueueRequestForLabelOwner(r.mgr.GetScheme(), owner),
+	}
+	if opts.RateLimitInterval > 0 {
+		h = rateLimitedHandler{EventHandler: h, interval: opts.RateLimitInterval}
+	}
+	src := &dynamicSource{
+		cache:          r.mgr.GetCache(),
+		obj:            o,
+		handler:        h,
+		predicates:     opts.Predicates,
+		removeInformer: opts.RemoveInformer,
+		users:          &r.informers,
+	}
+	err = ctrl.Watch(src)
 	if err != nil {
 		return err
 	}
+	r.typeTracker.setWatch(gvk, src)
 	return nil
 }
 
+// releaseTypes stops the dynamic watches of the types that are
+// no longer in use by any owner
+func (r *Reconciler) releaseTypes(ctx context.Context, released []releasedType) {
+	logger := logr.FromContextOrDiscard(ctx)
+	for _, t := range released {
+		logger.V(1).Info("resource type no longer in use", "gvk", t.gvk.String())
+		if t.source == nil {
+			continue
+		}
+		if err := t.source.stop(ctx); err != nil {
+			logger.Error(err, "unable to stop watch", "gvk", t.gvk.String())
+		}
+	}
+}
+
 // BuildTypeTracker passes the controller to the reconciler so watches
 // can be added dynamically
 func (r *Reconciler) BuildTypeTracker(ctrl controller.Controller) {
-	r.typeTracker = typeTracker{
-		seenTypes: []schema.GroupVersionKind{},
-		ctrl:      ctrl,
-	}
+	r.typeTracker.mu.Lock()
+	defer r.typeTracker.mu.Unlock()
+	r.typeTracker.ctrl = ctrl
 }
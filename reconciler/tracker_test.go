@@ -0,0 +1,172 @@
+package reconciler
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func Test_typeTracker_trackType(t *testing.T) {
+	type fields struct {
+		seenTypes []schema.GroupVersionKind
+	}
+	type args struct {
+		gvk schema.GroupVersionKind
+	}
+	tests := []struct {
+		name        string
+		fields      fields
+		args        args
+		want        []schema.GroupVersionKind
+		wantChanged bool
+	}{
+		{
+			name: "Adds the type",
+			fields: fields{
+				seenTypes: []schema.GroupVersionKind{
+					{Group: "", Version: "v1", Kind: "ServiceAccount"},
+				},
+			},
+			args: args{
+				gvk: schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Service"},
+			},
+			want: []schema.GroupVersionKind{
+				{Group: "", Version: "v1", Kind: "Service"},
+				{Group: "", Version: "v1", Kind: "ServiceAccount"},
+			},
+			wantChanged: true,
+		},
+		{
+			name: "Does nothing",
+			fields: fields{
+				seenTypes: []schema.GroupVersionKind{
+					{Group: "", Version: "v1", Kind: "Service"},
+				},
+			},
+			args: args{
+				gvk: schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Service"},
+			},
+			want: []schema.GroupVersionKind{
+				{Group: "", Version: "v1", Kind: "Service"},
+			},
+			wantChanged: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := &typeTracker{}
+			for _, gvk := range tt.fields.seenTypes {
+				tracker.trackType(gvk)
+			}
+			if got := tracker.trackType(tt.args.gvk); got != tt.wantChanged {
+				t.Errorf("(*typeTracker).trackType() = %v, want %v", got, tt.wantChanged)
+			}
+			if !reflect.DeepEqual(tracker.seenTypes(), tt.want) {
+				t.Errorf("(*typeTracker).trackType() = %v, want %v", tracker.seenTypes(), tt.want)
+			}
+		})
+	}
+}
+
+func Test_typeTracker_concurrentTrackType(t *testing.T) {
+	tracker := &typeTracker{}
+	gvks := []schema.GroupVersionKind{
+		{Group: "", Version: "v1", Kind: "Service"},
+		{Group: "", Version: "v1", Kind: "ConfigMap"},
+		{Group: "apps", Version: "v1", Kind: "Deployment"},
+	}
+
+	var added atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		for _, gvk := range gvks {
+			wg.Add(1)
+			go func(gvk schema.GroupVersionKind) {
+				defer wg.Done()
+				if tracker.trackType(gvk) {
+					added.Add(1)
+				}
+				// concurrent readers
+				_ = tracker.seenTypes()
+			}(gvk)
+		}
+	}
+	wg.Wait()
+
+	if got := int(added.Load()); got != len(gvks) {
+		t.Errorf("(*typeTracker).trackType() reported %v additions, want %v", got, len(gvks))
+	}
+	if got := len(tracker.seenTypes()); got != len(gvks) {
+		t.Errorf("(*typeTracker).seenTypes() has %v types, want %v", got, len(gvks))
+	}
+}
+
+func Test_typeTracker_trackLabelOwnedType(t *testing.T) {
+	tracker := &typeTracker{}
+	gvk := schema.GroupVersionKind{Group: "rbac.authorization.k8s.io", Version: "v1", Kind: "ClusterRole"}
+
+	tracker.trackType(gvk)
+	if tracker.isLabelOwnedType(gvk) {
+		t.Errorf("(*typeTracker).isLabelOwnedType() = true, want false")
+	}
+	if !tracker.trackLabelOwnedType(gvk) {
+		t.Errorf("(*typeTracker).trackLabelOwnedType() = false, want true")
+	}
+	if tracker.trackLabelOwnedType(gvk) {
+		t.Errorf("(*typeTracker).trackLabelOwnedType() = true, want false")
+	}
+	if !reflect.DeepEqual(tracker.labelOwnedTypes(), []schema.GroupVersionKind{gvk}) {
+		t.Errorf("(*typeTracker).labelOwnedTypes() = %v, want %v", tracker.labelOwnedTypes(), []schema.GroupVersionKind{gvk})
+	}
+}
+
+func Test_typeTracker_controller(t *testing.T) {
+	tracker := &typeTracker{}
+	if _, err := tracker.controller(); err != errNoController {
+		t.Errorf("(*typeTracker).controller() error = %v, want %v", err, errNoController)
+	}
+	tracker.ctrl = &testController{}
+	if _, err := tracker.controller(); err != nil {
+		t.Errorf("(*typeTracker).controller() error = %v", err)
+	}
+}
+
+func Test_typeTracker_releaseUnusedTypes(t *testing.T) {
+	tracker := &typeTracker{}
+	ownerA := client.ObjectKey{Name: "a", Namespace: "ns"}
+	ownerB := client.ObjectKey{Name: "b", Namespace: "ns"}
+	service := schema.GroupVersionKind{Group: "", Version: "v1", Kind: "Service"}
+	configMap := schema.GroupVersionKind{Group: "", Version: "v1", Kind: "ConfigMap"}
+	src := &dynamicSource{}
+
+	if !tracker.acquireType(ownerA, service) {
+		t.Errorf("(*typeTracker).acquireType() = false, want true")
+	}
+	tracker.setWatch(service, src)
+	tracker.acquireType(ownerA, configMap)
+	if tracker.acquireType(ownerB, service) {
+		t.Errorf("(*typeTracker).acquireType() = true, want false")
+	}
+
+	// ownerA stops using the Service type, which is still used by ownerB
+	if got := tracker.releaseUnusedTypes(ownerA, []schema.GroupVersionKind{configMap}); len(got) != 0 {
+		t.Errorf("(*typeTracker).releaseUnusedTypes() = %v, want none", got)
+	}
+	// ownerB is deleted
+	want := []releasedType{{gvk: service, source: src}}
+	if got := tracker.releaseOwner(ownerB); !reflect.DeepEqual(got, want) {
+		t.Errorf("(*typeTracker).releaseOwner() = %v, want %v", got, want)
+	}
+	if got := tracker.seenTypes(); !reflect.DeepEqual(got, []schema.GroupVersionKind{configMap}) {
+		t.Errorf("(*typeTracker).seenTypes() = %v, want %v", got, []schema.GroupVersionKind{configMap})
+	}
+
+	// the type can be acquired again
+	if !tracker.acquireType(ownerB, service) {
+		t.Errorf("(*typeTracker).acquireType() = false, want true")
+	}
+}
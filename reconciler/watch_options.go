@@ -0,0 +1,166 @@
+package reconciler
+
+import (
+	"context"
+	"time"
+
+	"github.com/3scale-ops/basereconciler/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// DynamicWatchOptions configures the watches that the reconciler adds dynamically
+// for the owned resource types (see SetupWithDynamicTypeWatches).
+type DynamicWatchOptions struct {
+	// Predicates filter the events of the watched resources before they
+	// trigger a reconcile of the owner. The predicates in the controller-runtime
+	// predicate package can be used, like predicate.GenerationChangedPredicate,
+	// predicate.LabelChangedPredicate or predicate.AnnotationChangedPredicate, as
+	// well as custom ones (see predicate.NewPredicateFuncs).
+	Predicates []predicate.Predicate
+	// MetadataOnly configures the watch to only cache the metadata of the
+	// resources (using metav1.PartialObjectMetadata). The resource pruner
+	// will also use metadata only requests to list the resources of this type.
+	// This reduces memory usage for types whose contents the controller does not
+	// need to read. The full objects that ReconcileOwnedResources reads to reconcile
+	// the resources of this type are read directly from the API server (see
+	// WithAPIReader), so no informer with the full objects is started for the type.
+	MetadataOnly bool
+	// RateLimitInterval, when set, delays the reconcile requests triggered by
+	// the watch by the given interval. Requests for the same owner that happen within
+	// the interval are coalesced into a single one.
+	RateLimitInterval time.Duration
+	// RemoveInformer stops the informer of the type once the type is no longer in use
+	// by any owner and its dynamic watch is stopped, releasing its resources. The informer
+	// is kept if other dynamic watches of the reconciler (like the ones used for reference
+	// tracking) still use it. By default informers are kept running, as the cache shares them
+	// with the static watches of the controller (Owns or Watches in the controller builder)
+	// and with the cached client, which would break if the informer was stopped. Only set it
+	// for types that are not used in any of those ways.
+	RemoveInformer bool
+}
+
+// WithDynamicWatchOptions configures the options for the dynamic watch of the given
+// GVK. If the passed GVK is an empty one ("schema.GroupVersionKind{}"), the options are
+// used as the default for any GVK that has not been explicitly configured.
+// It must be called before the controller is started.
+func (r *Reconciler) WithDynamicWatchOptions(gvk schema.GroupVersionKind, opts DynamicWatchOptions) *Reconciler {
+	if r.watchOptions == nil {
+		r.watchOptions = map[schema.GroupVersionKind]DynamicWatchOptions{}
+	}
+	r.watchOptions[gvk] = opts
+	return r
+}
+
+// dynamicWatchOptions returns the watch options configured for the GVK
+func (r *Reconciler) dynamicWatchOptions(gvk schema.GroupVersionKind) DynamicWatchOptions {
+	if opts, ok := r.watchOptions[gvk]; ok {
+		return opts
+	}
+	return r.watchOptions[schema.GroupVersionKind{}]
+}
+
+// newWatchedObject returns an object of the given GVK, as it is
+// stored in the cache used by the dynamic watch
+func (r *Reconciler) newWatchedObject(gvk schema.GroupVersionKind) (client.Object, error) {
+	if r.dynamicWatchOptions(gvk).MetadataOnly {
+		o := &metav1.PartialObjectMetadata{}
+		o.SetGroupVersionKind(gvk)
+		return o, nil
+	}
+	return util.NewObjectFromGVK(gvk, r.Scheme)
+}
+
+// newWatchedObjectList returns a list of objects of the given GVK, as they
+// are stored in the cache used by the dynamic watch
+func (r *Reconciler) newWatchedObjectList(gvk schema.GroupVersionKind) (client.ObjectList, error) {
+	if r.dynamicWatchOptions(gvk).MetadataOnly {
+		o := &metav1.PartialObjectMetadataList{}
+		o.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		return o, nil
+	}
+	return util.NewObjectListFromGVK(gvk, r.Scheme)
+}
+
+// watchedObjectListItems returns the items of a list obtained with newWatchedObjectList.
+// Metadata only objects are returned with their GVK set, as the client
+// requires it to operate on them.
+func watchedObjectListItems(list client.ObjectList, gvk schema.GroupVersionKind) []client.Object {
+	items := util.GetItems(list)
+	if _, ok := list.(*metav1.PartialObjectMetadataList); ok {
+		for _, item := range items {
+			item.GetObjectKind().SetGroupVersionKind(gvk)
+		}
+	}
+	return items
+}
+
+// uncachedReader returns the reader that reads directly from the API server (see
+// WithAPIReader), falling back to the manager's one and then to the Reconciler's client
+func (r *Reconciler) uncachedReader() client.Reader {
+	switch {
+	case r.apiReader != nil:
+		return r.apiReader
+	case r.mgr != nil:
+		return r.mgr.GetAPIReader()
+	}
+	return r.Client
+}
+
+// metadataOnlyClient reads the full objects of the MetadataOnly types directly from
+// the API server, as reading them through the cached client would start an informer
+// that caches the full objects
+type metadataOnlyClient struct {
+	client.Client
+	r *Reconciler
+}
+
+func (c metadataOnlyClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	if _, ok := obj.(*metav1.PartialObjectMetadata); !ok {
+		if gvk, err := apiutil.GVKForObject(obj, c.r.Scheme); err == nil && c.r.dynamicWatchOptions(gvk).MetadataOnly {
+			return c.r.uncachedReader().Get(ctx, key, obj, opts...)
+		}
+	}
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+// rateLimitedHandler is an EventHandler that delays the reconcile requests
+// so they get coalesced within the given interval
+type rateLimitedHandler struct {
+	handler.EventHandler
+	interval time.Duration
+}
+
+func (h rateLimitedHandler) Create(ctx context.Context, e event.CreateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	h.EventHandler.Create(ctx, e, delayingQueue{q, h.interval})
+}
+
+func (h rateLimitedHandler) Update(ctx context.Context, e event.UpdateEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	h.EventHandler.Update(ctx, e, delayingQueue{q, h.interval})
+}
+
+func (h rateLimitedHandler) Delete(ctx context.Context, e event.DeleteEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	h.EventHandler.Delete(ctx, e, delayingQueue{q, h.interval})
+}
+
+func (h rateLimitedHandler) Generic(ctx context.Context, e event.GenericEvent, q workqueue.TypedRateLimitingInterface[reconcile.Request]) {
+	h.EventHandler.Generic(ctx, e, delayingQueue{q, h.interval})
+}
+
+// delayingQueue replaces Add with AddAfter. The workqueue keeps only one
+// waiting entry per item, so requests within the delay are coalesced.
+type delayingQueue struct {
+	workqueue.TypedRateLimitingInterface[reconcile.Request]
+	delay time.Duration
+}
+
+func (q delayingQueue) Add(item reconcile.Request) {
+	q.TypedRateLimitingInterface.AddAfter(item, q.delay)
+}
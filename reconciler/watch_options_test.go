@@ -0,0 +1,158 @@
+package reconciler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/3scale-ops/basereconciler/resource"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconciler_dynamicWatchOptions(t *testing.T) {
+	secretGVK := schema.FromAPIVersionAndKind("v1", "Secret")
+	configMapGVK := schema.FromAPIVersionAndKind("v1", "ConfigMap")
+
+	tests := []struct {
+		name string
+		r    *Reconciler
+		gvk  schema.GroupVersionKind
+		want DynamicWatchOptions
+	}{
+		{
+			name: "Returns empty options",
+			r:    &Reconciler{},
+			gvk:  secretGVK,
+			want: DynamicWatchOptions{},
+		},
+		{
+			name: "Returns the options for the GVK",
+			r: (&Reconciler{}).
+				WithDynamicWatchOptions(secretGVK, DynamicWatchOptions{MetadataOnly: true}).
+				WithDynamicWatchOptions(schema.GroupVersionKind{}, DynamicWatchOptions{RateLimitInterval: time.Second}),
+			gvk:  secretGVK,
+			want: DynamicWatchOptions{MetadataOnly: true},
+		},
+		{
+			name: "Returns the default options",
+			r: (&Reconciler{}).
+				WithDynamicWatchOptions(secretGVK, DynamicWatchOptions{MetadataOnly: true}).
+				WithDynamicWatchOptions(schema.GroupVersionKind{}, DynamicWatchOptions{RateLimitInterval: time.Second}),
+			gvk:  configMapGVK,
+			want: DynamicWatchOptions{RateLimitInterval: time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.r.dynamicWatchOptions(tt.gvk), tt.want); len(diff) > 0 {
+				t.Errorf("Reconciler.dynamicWatchOptions() diff = %v", diff)
+			}
+		})
+	}
+}
+
+func TestReconciler_newWatchedObject(t *testing.T) {
+	gvk := schema.FromAPIVersionAndKind("v1", "Secret")
+
+	r := &Reconciler{Scheme: scheme.Scheme}
+	o, err := r.newWatchedObject(gvk)
+	if err != nil {
+		t.Fatalf("Reconciler.newWatchedObject() error = %v", err)
+	}
+	if _, ok := o.(*corev1.Secret); !ok {
+		t.Errorf("Reconciler.newWatchedObject() got %T, want *v1.Secret", o)
+	}
+
+	r.WithDynamicWatchOptions(gvk, DynamicWatchOptions{MetadataOnly: true})
+	o, err = r.newWatchedObject(gvk)
+	if err != nil {
+		t.Fatalf("Reconciler.newWatchedObject() error = %v", err)
+	}
+	if m, ok := o.(*metav1.PartialObjectMetadata); !ok || m.GroupVersionKind() != gvk {
+		t.Errorf("Reconciler.newWatchedObject() got %T, want metadata only object for %s", o, gvk)
+	}
+
+	list, err := r.newWatchedObjectList(gvk)
+	if err != nil {
+		t.Fatalf("Reconciler.newWatchedObjectList() error = %v", err)
+	}
+	if got := list.GetObjectKind().GroupVersionKind(); got != schema.FromAPIVersionAndKind("v1", "SecretList") {
+		t.Errorf("Reconciler.newWatchedObjectList() got GVK %s", got)
+	}
+}
+
+func Test_metadataOnlyClient_Get(t *testing.T) {
+	errCached := errors.New("read from the cache")
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"}}
+	configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+	reader := fake.NewClientBuilder().WithObjects(secret, configmap).Build()
+	cached := interceptor.NewClient(reader, interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, ok := obj.(*corev1.Secret); ok || obj.GetObjectKind().GroupVersionKind().Kind == "Secret" {
+				return errCached
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	})
+	r := (&Reconciler{Client: cached, Scheme: scheme.Scheme}).WithAPIReader(reader)
+	c := metadataOnlyClient{Client: r.Client, r: r}
+
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(secret), &corev1.Secret{}); !errors.Is(err, errCached) {
+		t.Errorf("metadataOnlyClient.Get() error = %v, want %v", err, errCached)
+	}
+
+	r.WithDynamicWatchOptions(schema.FromAPIVersionAndKind("v1", "Secret"), DynamicWatchOptions{MetadataOnly: true})
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(secret), &corev1.Secret{}); err != nil {
+		t.Errorf("metadataOnlyClient.Get() error = %v, want the object to be read through the API reader", err)
+	}
+	m := &metav1.PartialObjectMetadata{}
+	m.SetGroupVersionKind(schema.FromAPIVersionAndKind("v1", "Secret"))
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(secret), m); !errors.Is(err, errCached) {
+		t.Errorf("metadataOnlyClient.Get() error = %v, want metadata reads to go through the cached client", err)
+	}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(configmap), &corev1.ConfigMap{}); err != nil {
+		t.Errorf("metadataOnlyClient.Get() error = %v", err)
+	}
+}
+
+func Test_rateLimitedHandler(t *testing.T) {
+	q := workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[reconcile.Request]())
+	defer q.ShutDown()
+
+	h := rateLimitedHandler{
+		EventHandler: EnqueueRequestForLabelOwner(scheme.Scheme, &corev1.ServiceAccount{}),
+		interval:     100 * time.Millisecond,
+	}
+	o := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "other",
+		Labels:      map[string]string{resource.OwnerUIDLabelKey(): "uid"},
+		Annotations: labelOwnerAnnotations("ServiceAccount", "owner", "ns"),
+	}}
+
+	for i := 0; i < 5; i++ {
+		h.Update(context.TODO(), event.UpdateEvent{ObjectOld: o, ObjectNew: o}, q)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("rateLimitedHandler got %d requests, want requests to be delayed", q.Len())
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if q.Len() != 1 {
+		t.Fatalf("rateLimitedHandler got %d requests, want 1", q.Len())
+	}
+	item, _ := q.Get()
+	if diff := cmp.Diff(item, reconcile.Request{NamespacedName: types.NamespacedName{Name: "owner", Namespace: "ns"}}); len(diff) > 0 {
+		t.Errorf("rateLimitedHandler diff = %v", diff)
+	}
+}
@@ -0,0 +1,148 @@
+package resource
+
+import (
+	"fmt"
+
+	"github.com/3scale-ops/basereconciler/config"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// AdoptionPolicy defines what happens when a template describes a resource that already
+// exists but is not owned by the owner
+type AdoptionPolicy string
+
+const (
+	// AdoptionPolicyIgnore does not adopt existing resources: resources without a controller are
+	// updated, or deleted if the template is disabled, without setting the owner. Resources controlled
+	// by a different object are never updated nor deleted, and produce an AdoptionConflictError.
+	// This is the default policy.
+	AdoptionPolicyIgnore AdoptionPolicy = "Ignore"
+	// AdoptionPolicyAdopt sets the owner of resources that have no controller. Resources controlled
+	// by a different object are never adopted nor deleted, and produce an AdoptionConflictError.
+	// Note that adopted resources are garbage collected when the owner is deleted.
+	AdoptionPolicyAdopt AdoptionPolicy = "Adopt"
+	// AdoptionPolicyRefuse never adopts resources: any resource not owned by the
+	// owner produces an AdoptionConflictError.
+	AdoptionPolicyRefuse AdoptionPolicy = "Refuse"
+	// AdoptionPolicyAdoptIfLabeled only adopts resources that carry the adoption label
+	// (see AdoptionLabelKey) with the "true" value. The label is an explicit consent to take
+	// over the resource, so the resource is adopted even if it is controlled by a different
+	// object. Resources without the label produce an AdoptionConflictError.
+	AdoptionPolicyAdoptIfLabeled AdoptionPolicy = "AdoptIfLabeled"
+)
+
+// AdoptionLabelKey returns the label that allows the adoption of resources
+// when AdoptionPolicyAdoptIfLabeled is used
+func AdoptionLabelKey() string {
+	return fmt.Sprintf("%s/adopt", config.GetAnnotationsDomain())
+}
+
+// TemplateWithAdoptionPolicy is an optional interface that templates can implement to configure
+// the adoption policy of the resource. Templates that don't implement it use AdoptionPolicyIgnore.
+type TemplateWithAdoptionPolicy interface {
+	GetAdoptionPolicy() AdoptionPolicy
+}
+
+// adoptionPolicy returns the adoption policy of the template
+func adoptionPolicy(template TemplateInterface) AdoptionPolicy {
+	if t, ok := TemplateAs[TemplateWithAdoptionPolicy](template); ok && t.GetAdoptionPolicy() != "" {
+		return t.GetAdoptionPolicy()
+	}
+	return AdoptionPolicyIgnore
+}
+
+// AdoptionConflictError is returned by CreateOrUpdate when an existing resource is
+// not owned by the owner and the adoption policy does not allow to adopt it
+type AdoptionConflictError struct {
+	// Object is a reference to the existing resource, in "Kind namespace/name" format
+	Object string
+	// Controller is the controller of the existing resource, in "Kind/name" format, or
+	// an empty string if it has no controller
+	Controller string
+	// Policy is the adoption policy that refused the adoption
+	Policy AdoptionPolicy
+}
+
+func (e *AdoptionConflictError) Error() string {
+	if e.Controller != "" {
+		return fmt.Sprintf("%s is controlled by %s, refusing to adopt it (adoption policy %s)", e.Object, e.Controller, e.Policy)
+	}
+	return fmt.Sprintf("%s exists and is not owned, refusing to adopt it (adoption policy %s)", e.Object, e.Policy)
+}
+
+// adopt checks if the live object is owned by the owner and, if it is not, adopts it if the adoption
+// policy allows it. It returns true if the live object has been modified and needs to be updated.
+func adopt(owner, live client.Object, gvk schema.GroupVersionKind, policy AdoptionPolicy, scheme *runtime.Scheme) (bool, error) {
+	ownerGVK, err := apiutil.GVKForObject(owner, scheme)
+	if err != nil {
+		return false, fmt.Errorf("unable to get GVK for owner: %w", err)
+	}
+	if IsOwnedBy(live, owner, ownerGVK) {
+		return false, nil
+	}
+
+	conflict := &AdoptionConflictError{
+		Object:     fmt.Sprintf("%s %s", gvk.Kind, client.ObjectKeyFromObject(live)),
+		Controller: controllerOf(live),
+		Policy:     policy,
+	}
+
+	switch policy {
+	case AdoptionPolicyIgnore:
+		// resources controlled by other objects must never be taken over
+		if conflict.Controller != "" {
+			return false, conflict
+		}
+		return false, nil
+	case AdoptionPolicyRefuse:
+		return false, conflict
+	case AdoptionPolicyAdoptIfLabeled:
+		if live.GetLabels()[AdoptionLabelKey()] != "true" {
+			return false, conflict
+		}
+		// remove the current controller, so the new one can be set
+		refs := []metav1.OwnerReference{}
+		for _, ref := range live.GetOwnerReferences() {
+			if ref.Controller == nil || !*ref.Controller {
+				refs = append(refs, ref)
+			}
+		}
+		live.SetOwnerReferences(refs)
+		if labels := live.GetLabels(); labels != nil {
+			delete(labels, AdoptionLabelKey())
+			live.SetLabels(labels)
+		}
+	default:
+		if conflict.Controller != "" {
+			return false, conflict
+		}
+	}
+
+	if err := SetOwner(owner, live, scheme); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// isOwnedBy returns true if the object is owned by the owner
+func isOwnedBy(o, owner client.Object, scheme *runtime.Scheme) bool {
+	ownerGVK, err := apiutil.GVKForObject(owner, scheme)
+	return err == nil && IsOwnedBy(o, owner, ownerGVK)
+}
+
+// controllerOf returns the controller of the object, either through an OwnerReference or
+// through labels, in "Kind/name" format. An empty string is returned if the object has no
+// controller.
+func controllerOf(o client.Object) string {
+	if ref := metav1.GetControllerOf(o); ref != nil {
+		return fmt.Sprintf("%s/%s", schema.FromAPIVersionAndKind(ref.APIVersion, ref.Kind).GroupKind(), ref.Name)
+	}
+	if gk, key, ok := GetLabelOwner(o); ok {
+		return fmt.Sprintf("%s/%s", gk, key)
+	}
+	return ""
+}
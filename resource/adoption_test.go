@@ -0,0 +1,104 @@
+package resource
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/util"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+)
+
+func Test_adopt(t *testing.T) {
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}}
+	ownerRef := metav1.OwnerReference{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner",
+		Controller: util.Pointer(true), BlockOwnerDeletion: util.Pointer(true)}
+	otherRef := metav1.OwnerReference{APIVersion: "v1", Kind: "ServiceAccount", Name: "other",
+		Controller: util.Pointer(true)}
+	gvk := schema.FromAPIVersionAndKind("v1", "ConfigMap")
+
+	tests := []struct {
+		name         string
+		live         *corev1.ConfigMap
+		policy       AdoptionPolicy
+		want         bool
+		wantConflict bool
+		wantRefs     []metav1.OwnerReference
+	}{
+		{
+			name:     "Does nothing if already owned",
+			live:     &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns", OwnerReferences: []metav1.OwnerReference{ownerRef}}},
+			policy:   AdoptionPolicyRefuse,
+			want:     false,
+			wantRefs: []metav1.OwnerReference{ownerRef},
+		},
+		{
+			name:   "Ignores the ownership of resources without controller by default",
+			live:   &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			policy: adoptionPolicy(NewTemplateFromObjectFunction(func() *corev1.ConfigMap { return &corev1.ConfigMap{} })),
+			want:   false,
+		},
+		{
+			name:         "Refuses resources controlled by other objects by default",
+			live:         &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns", OwnerReferences: []metav1.OwnerReference{otherRef}}},
+			policy:       adoptionPolicy(NewTemplateFromObjectFunction(func() *corev1.ConfigMap { return &corev1.ConfigMap{} })),
+			wantConflict: true,
+			wantRefs:     []metav1.OwnerReference{otherRef},
+		},
+		{
+			name:     "Adopts resources without controller",
+			live:     &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			policy:   AdoptionPolicyAdopt,
+			want:     true,
+			wantRefs: []metav1.OwnerReference{ownerRef},
+		},
+		{
+			name:         "Does not adopt resources controlled by other objects",
+			live:         &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns", OwnerReferences: []metav1.OwnerReference{otherRef}}},
+			policy:       AdoptionPolicyAdopt,
+			wantConflict: true,
+			wantRefs:     []metav1.OwnerReference{otherRef},
+		},
+		{
+			name:         "Refuses to adopt",
+			live:         &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			policy:       AdoptionPolicyRefuse,
+			wantConflict: true,
+		},
+		{
+			name:         "Refuses to adopt resources without the adoption label",
+			live:         &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			policy:       AdoptionPolicyAdoptIfLabeled,
+			wantConflict: true,
+		},
+		{
+			name: "Takes over resources with the adoption label",
+			live: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+				Labels: map[string]string{AdoptionLabelKey(): "true"}, OwnerReferences: []metav1.OwnerReference{otherRef}}},
+			policy:   AdoptionPolicyAdoptIfLabeled,
+			want:     true,
+			wantRefs: []metav1.OwnerReference{ownerRef},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := adopt(owner, tt.live, gvk, tt.policy, scheme.Scheme)
+			conflict := &AdoptionConflictError{}
+			if errors.As(err, &conflict) != tt.wantConflict {
+				t.Fatalf("adopt() error = %v, wantConflict %v", err, tt.wantConflict)
+			}
+			if got != tt.want {
+				t.Errorf("adopt() = %v, want %v", got, tt.want)
+			}
+			if diff := cmp.Diff(tt.live.GetOwnerReferences(), tt.wantRefs); len(diff) > 0 {
+				t.Errorf("adopt() owner references diff = %v", diff)
+			}
+			if _, ok := tt.live.GetLabels()[AdoptionLabelKey()]; ok && got {
+				t.Errorf("adopt() expected the adoption label to be removed")
+			}
+		})
+	}
+}
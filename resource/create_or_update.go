@@ -19,7 +19,6 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
-	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 )
 
 // CreateOrUpdate cretes or updates resources. The function receives several parameters:
@@ -27,10 +26,19 @@ import (
 //     produce any logs.
 //   - cl: the kubernetes API client
 //   - scheme: the kubernetes API scheme
-//   - owner: the object that owns the resource. Used to set the OwnerReference in the resource
+//   - owner: the object that owns the resource. Used to set the OwnerReference in the resource. Cluster scoped
+//     resources and resources in a namespace different from the owner's are owned through labels instead
+//     (see SetOwner).
 //   - template: the struct that describes how the resource needs to be reconciled. It must implement
 //     the TemplateInterface interface. When template.GetEnsureProperties is not set or an empty list, this
-//     function will lookup for configuration in the global configuration (see package config).
+//     function will lookup for configuration in the global configuration (see package config). Templates
+//     with ReconcilePolicyCreateOnly are created if missing, but never updated (see TemplateWithReconcilePolicy).
+//     Templates with PresenceUnmanaged are not created, updated nor deleted, but a reference is returned if the
+//     resource exists so it is kept by the resource pruner (see TemplateWithPresence). Templates with an adoption
+//     policy other than the default AdoptionPolicyIgnore adopt existing resources that are not owned by the owner,
+//     or refuse them with an AdoptionConflictError, and never delete resources controlled by other objects (see
+//     TemplateWithAdoptionPolicy). The hooks of the template are called around the creation, update and deletion of the
+//     resource (see TemplateWithHooks).
 func CreateOrUpdate(ctx context.Context, cl client.Client, scheme *runtime.Scheme,
 	owner client.Object, template TemplateInterface) (*corev1.ObjectReference, error) {
 
@@ -46,22 +54,38 @@ func CreateOrUpdate(ctx context.Context, cl client.Client, scheme *runtime.Schem
 	}
 	logger := logr.FromContextOrDiscard(ctx).WithValues("gvk", gvk, "resource", desired.GetName())
 
+	// label based ownership needs to be present in the desired object so
+	// the ownership labels are not removed when the resource is updated
+	if RequiresLabelOwnership(owner, desired.GetNamespace()) {
+		if err := setLabelOwner(owner, desired, scheme); err != nil {
+			return nil, wrapError("unable to set label owner", key, gvk, err)
+		}
+	}
+
 	live, err := util.NewObjectFromGVK(gvk, scheme)
 	if err != nil {
 		return nil, wrapError("unable to create object from GVK", key, gvk, err)
 	}
+	presence := presence(template)
+	preHooks, postHooks := hooks(template)
 	err = cl.Get(ctx, key, live)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			if template.Enabled() {
-				if err := controllerutil.SetControllerReference(owner, desired, scheme); err != nil {
-					return nil, wrapError("unable to set controller reference", key, gvk, err)
+			if presence == PresencePresent {
+				if err := SetOwner(owner, desired, scheme); err != nil {
+					return nil, wrapError("unable to set owner", key, gvk, err)
+				}
+				if err := RunHooks(ctx, cl, preHooks, ActionCreate, nil, desired); err != nil {
+					return nil, wrapError("pre create hook failed for resource", key, gvk, err)
 				}
 				err = cl.Create(ctx, util.SetTypeMeta(desired, gvk))
 				if err != nil {
 					return nil, wrapError("unable to create resource", key, gvk, err)
 				}
 				logger.Info("resource created")
+				if err := RunHooks(ctx, cl, postHooks, ActionCreate, desired, desired); err != nil {
+					return nil, wrapError("post create hook failed for resource", key, gvk, err)
+				}
 				return util.ObjectReference(desired, gvk), nil
 
 			} else {
@@ -71,16 +95,49 @@ func CreateOrUpdate(ctx context.Context, cl client.Client, scheme *runtime.Schem
 		return nil, wrapError("unable to get resource", key, gvk, err)
 	}
 
+	/* Return without changes if unmanaged */
+	if presence == PresenceUnmanaged {
+		return util.ObjectReference(live, gvk), nil
+	}
+
 	/* Delete and return if not enabled */
-	if !template.Enabled() {
+	if presence == PresenceAbsent {
+		// never delete resources controlled by other objects
+		if controller := controllerOf(live); controller != "" && !isOwnedBy(live, owner, scheme) {
+			logger.Info("resource controlled by another object not deleted", "controller", controller)
+			return nil, nil
+		}
+		if err := RunHooks(ctx, cl, preHooks, ActionDelete, live, nil); err != nil {
+			return nil, wrapError("pre delete hook failed for resource", key, gvk, err)
+		}
 		err := cl.Delete(ctx, live)
 		if err != nil {
 			return nil, wrapError("unable to delete object", key, gvk, err)
 		}
 		logger.Info("resource deleted")
+		if err := RunHooks(ctx, cl, postHooks, ActionDelete, live, nil); err != nil {
+			return nil, wrapError("post delete hook failed for resource", key, gvk, err)
+		}
 		return nil, nil
 	}
 
+	/* Adopt the resource if it is not owned by the owner */
+	adopted, err := adopt(owner, live, gvk, adoptionPolicy(template), scheme)
+	if err != nil {
+		return nil, wrapError("unable to adopt resource", key, gvk, err)
+	}
+	if adopted {
+		if err := cl.Update(ctx, live); err != nil {
+			return nil, wrapError("unable to adopt resource", key, gvk, err)
+		}
+		logger.Info("resource adopted")
+	}
+
+	/* Do not update if the resource is create only */
+	if reconcilePolicy(template) == ReconcilePolicyCreateOnly {
+		return util.ObjectReference(live, gvk), nil
+	}
+
 	ensure, ignore, err := reconcilerConfig(template, gvk)
 	if err != nil {
 		return nil, wrapError("unable to retrieve config for resource reconciler", key, gvk, err)
@@ -89,12 +146,12 @@ func CreateOrUpdate(ctx context.Context, cl client.Client, scheme *runtime.Schem
 	// normalize both live and desired for comparison
 	normalizedDesired, err := normalize(desired, ensure, ignore, gvk, scheme)
 	if err != nil {
-		wrapError("unable to normalize desired", key, gvk, err)
+		return nil, wrapError("unable to normalize desired", key, gvk, err)
 	}
 
 	normalizedLive, err := normalize(live, ensure, ignore, gvk, scheme)
 	if err != nil {
-		wrapError("unable to normalize live", key, gvk, err)
+		return nil, wrapError("unable to normalize live", key, gvk, err)
 	}
 
 	if !equality.Semantic.DeepEqual(normalizedLive, normalizedDesired) {
@@ -119,11 +176,28 @@ func CreateOrUpdate(ctx context.Context, cl client.Client, scheme *runtime.Schem
 			}
 		}
 
-		err = cl.Update(ctx, client.Object(&unstructured.Unstructured{Object: u_live}))
+		if err := RunHooks(ctx, cl, preHooks, ActionUpdate, live, desired); err != nil {
+			return nil, wrapError("pre update hook failed for resource", key, gvk, err)
+		}
+		updated := &unstructured.Unstructured{Object: u_live}
+		err = cl.Update(ctx, client.Object(updated))
 		if err != nil {
 			return nil, wrapError("unable to update resource", key, gvk, err)
 		}
 		logger.Info("Resource updated")
+		if len(postHooks) > 0 {
+			// hooks receive the same concrete type in all the actions
+			updatedLive, err := util.NewObjectFromGVK(gvk, scheme)
+			if err != nil {
+				return nil, wrapError("unable to create object from GVK", key, gvk, err)
+			}
+			if err := runtime.DefaultUnstructuredConverter.FromUnstructured(updated.UnstructuredContent(), updatedLive); err != nil {
+				return nil, wrapError("unable to convert from unstructured", key, gvk, err)
+			}
+			if err := RunHooks(ctx, cl, postHooks, ActionUpdate, updatedLive, desired); err != nil {
+				return nil, wrapError("post update hook failed for resource", key, gvk, err)
+			}
+		}
 	}
 
 	return util.ObjectReference(live, gvk), nil
@@ -9,6 +9,7 @@ import (
 	"github.com/google/go-cmp/cmp"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
@@ -282,6 +283,221 @@ func TestCreateOrUpdate(t *testing.T) {
 			wantObject:    &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "service", Namespace: "ns"}},
 			wantObjectErr: errors.IsNotFound,
 		},
+		{
+			name: "Does not update create only objects",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+					Data:       map[string]string{"key": "edited-by-user"},
+				}).Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data:       map[string]string{"key": "value"},
+					}
+				}).WithReconcilePolicy(ReconcilePolicyCreateOnly),
+			},
+			want: &corev1.ObjectReference{
+				Kind:       "ConfigMap",
+				Namespace:  "ns",
+				Name:       "cm",
+				APIVersion: "v1",
+			},
+			wantErr: false,
+			wantObject: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+				Data:       map[string]string{"key": "edited-by-user"},
+			},
+			wantObjectErr: nil,
+		},
+		{
+			name: "Creates create only objects",
+			args: args{
+				ctx:    context.TODO(),
+				cl:     fake.NewClientBuilder().Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data:       map[string]string{"key": "value"},
+					}
+				}).WithReconcilePolicy(ReconcilePolicyCreateOnly),
+			},
+			want: &corev1.ObjectReference{
+				Kind:       "ConfigMap",
+				Namespace:  "ns",
+				Name:       "cm",
+				APIVersion: "v1",
+			},
+			wantErr: false,
+			wantObject: &corev1.ConfigMap{
+				TypeMeta: metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+					OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner",
+						Controller: util.Pointer(true), BlockOwnerDeletion: util.Pointer(true)}}},
+				Data: map[string]string{"key": "value"},
+			},
+			wantObjectErr: nil,
+		},
+		{
+			name: "Does not update nor delete unmanaged objects",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+					Data:       map[string]string{"key": "edited-by-user"},
+				}).Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data:       map[string]string{"key": "value"},
+					}
+				}).WithPresence(PresenceUnmanaged),
+			},
+			want: &corev1.ObjectReference{
+				Kind:       "ConfigMap",
+				Namespace:  "ns",
+				Name:       "cm",
+				APIVersion: "v1",
+			},
+			wantErr: false,
+			wantObject: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+				Data:       map[string]string{"key": "edited-by-user"},
+			},
+			wantObjectErr: nil,
+		},
+		{
+			name: "Does not create unmanaged objects",
+			args: args{
+				ctx:    context.TODO(),
+				cl:     fake.NewClientBuilder().Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+				}).WithPresence(PresenceUnmanaged),
+			},
+			want:          nil,
+			wantErr:       false,
+			wantObject:    &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			wantObjectErr: errors.IsNotFound,
+		},
+		{
+			name: "Presence takes precedence over IsEnabled",
+			args: args{
+				ctx:    context.TODO(),
+				cl:     fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}).Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+				}).WithEnabled(true).WithPresence(PresenceAbsent),
+			},
+			want:          nil,
+			wantErr:       false,
+			wantObject:    &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			wantObjectErr: errors.IsNotFound,
+		},
+		{
+			name: "Does not update resources controlled by other objects",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "other", Controller: util.Pointer(true)}}},
+				}).Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data:       map[string]string{"key": "value"},
+					}
+				}).WithAdoptionPolicy(AdoptionPolicyAdopt),
+			},
+			want:    nil,
+			wantErr: true,
+			wantObject: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+			},
+			wantObjectErr: func(err error) bool { return err == nil },
+		},
+		{
+			name: "Does not delete resources controlled by other objects",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "other", Controller: util.Pointer(true)}}},
+				}).Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+				}).WithEnabled(false).WithAdoptionPolicy(AdoptionPolicyAdopt),
+			},
+			want:    nil,
+			wantErr: false,
+			wantObject: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+					OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "other", Controller: util.Pointer(true)}}},
+			},
+			wantObjectErr: func(err error) bool { return err == nil },
+		},
+		{
+			name: "Does not update resources controlled by other objects by default",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "other", Controller: util.Pointer(true)}}},
+				}).Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"},
+						Data:       map[string]string{"key": "value"},
+					}
+				}),
+			},
+			want:    nil,
+			wantErr: true,
+			wantObject: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+					OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "other", Controller: util.Pointer(true)}}},
+			},
+			wantObjectErr: func(err error) bool { return err == nil },
+		},
+		{
+			name: "Does not delete resources controlled by other objects by default",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(&corev1.ConfigMap{
+					ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+						OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "other", Controller: util.Pointer(true)}}},
+				}).Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}},
+				template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+					return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}}
+				}).WithEnabled(false),
+			},
+			want:    nil,
+			wantErr: false,
+			wantObject: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+					OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "other", Controller: util.Pointer(true)}}},
+			},
+			wantObjectErr: func(err error) bool { return err == nil },
+		},
 		{
 			name: "Create a Deployment",
 			args: args{
@@ -319,6 +535,91 @@ func TestCreateOrUpdate(t *testing.T) {
 			},
 			wantObjectErr: nil,
 		},
+		{
+			name: "Create a cluster scoped resource owned through labels",
+			args: args{
+				ctx:    context.TODO(),
+				cl:     fake.NewClientBuilder().Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"}},
+				template: &Template[*rbacv1.ClusterRole]{
+					TemplateBuilder: func(client.Object) (*rbacv1.ClusterRole, error) {
+						return &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cluster-role"}}, nil
+					},
+					IsEnabled: true,
+				},
+			},
+			want: &corev1.ObjectReference{
+				Kind:       "ClusterRole",
+				Name:       "cluster-role",
+				APIVersion: "rbac.authorization.k8s.io/v1",
+			},
+			wantErr: false,
+			wantObject: &rbacv1.ClusterRole{
+				TypeMeta: metav1.TypeMeta{Kind: "ClusterRole", APIVersion: "rbac.authorization.k8s.io/v1"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "cluster-role",
+					Labels: map[string]string{OwnerUIDLabelKey(): "uid"},
+					Annotations: map[string]string{
+						OwnerKindAnnotationKey():      "ServiceAccount",
+						OwnerNameAnnotationKey():      "owner",
+						OwnerNamespaceAnnotationKey(): "ns",
+					},
+				},
+			},
+			wantObjectErr: nil,
+		},
+		{
+			name: "Keeps owner labels when updating a resource in another namespace",
+			args: args{
+				ctx: context.TODO(),
+				cl: fake.NewClientBuilder().WithObjects(
+					&corev1.ConfigMap{
+						ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "other",
+							Labels: map[string]string{OwnerUIDLabelKey(): "uid"},
+							Annotations: map[string]string{
+								OwnerKindAnnotationKey():      "ServiceAccount",
+								OwnerNameAnnotationKey():      "owner",
+								OwnerNamespaceAnnotationKey(): "ns",
+							}},
+						Data: map[string]string{"key": "value"},
+					}).Build(),
+				scheme: scheme.Scheme,
+				owner:  &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"}},
+				template: &Template[*corev1.ConfigMap]{
+					TemplateBuilder: func(client.Object) (*corev1.ConfigMap, error) {
+						return &corev1.ConfigMap{
+							ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "other"},
+							Data:       map[string]string{"key": "new-value"},
+						}, nil
+					},
+					IsEnabled:        true,
+					EnsureProperties: []Property{"metadata.annotations", "metadata.labels", "data"},
+				},
+			},
+			want: &corev1.ObjectReference{
+				Kind:       "ConfigMap",
+				Namespace:  "other",
+				Name:       "cm",
+				APIVersion: "v1",
+			},
+			wantErr: false,
+			wantObject: &corev1.ConfigMap{
+				TypeMeta: metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "cm",
+					Namespace: "other",
+					Labels:    map[string]string{OwnerUIDLabelKey(): "uid"},
+					Annotations: map[string]string{
+						OwnerKindAnnotationKey():      "ServiceAccount",
+						OwnerNameAnnotationKey():      "owner",
+						OwnerNamespaceAnnotationKey(): "ns",
+					},
+				},
+				Data: map[string]string{"key": "new-value"},
+			},
+			wantObjectErr: nil,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
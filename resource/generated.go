@@ -0,0 +1,128 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/util"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// generatedNameHashLength is the length of the content hash
+// appended to the names of the generated objects
+const generatedNameHashLength = 10
+
+// GeneratedFromLabelKey returns the label that holds the base name of the objects created
+// from a GeneratedTemplate. The resource pruner uses it to keep the old generations of the
+// objects while they are still referenced by any workload.
+func GeneratedFromLabelKey() string {
+	return fmt.Sprintf("%s/generated-from", config.GetAnnotationsDomain())
+}
+
+// TemplateWithGeneratedName is implemented by templates whose object names are generated
+// from the object content (see GeneratedTemplate). It allows mutators.InjectGeneratedNames
+// to replace the references to the base name in the workloads with the generated name.
+type TemplateWithGeneratedName interface {
+	TemplateInterface
+	// GetBaseName returns the name of the object built by the template before
+	// the content hash is appended
+	GetBaseName() string
+	// GetGeneratedName returns the name generated in the last Build() call,
+	// or an empty string if the template has not been built yet
+	GetGeneratedName() string
+	// GetGeneratedKind returns the kind of the generated object
+	GetGeneratedKind() string
+}
+
+// GeneratedTemplate is a Template for ConfigMaps and Secrets, similar to the Kustomize generators,
+// that appends a hash of the content to the name of the object and creates it as immutable. Any change
+// to the content produces a new object with a different name, so workloads referencing it (see
+// mutators.InjectGeneratedNames) roll out when the content changes, without the need of a RolloutTrigger.
+// The previous generations are not updated, so failed rollouts keep working with their configuration. The
+// resource pruner deletes the old generations once no workload or pod references them anymore.
+// The generated name is only known after the template is built, so the template needs to come before the
+// templates that reference it in the list passed to the reconciler, and a new GeneratedTemplate should be
+// used in each reconcile.
+type GeneratedTemplate[T client.Object] struct {
+	*Template[T]
+	baseName      string
+	generatedName string
+}
+
+// NewGeneratedTemplate returns a new GeneratedTemplate using the passed TemplateBuilderFunction,
+// which must return a *corev1.ConfigMap or a *corev1.Secret
+func NewGeneratedTemplate[T client.Object](tb TemplateBuilderFunction[T]) *GeneratedTemplate[T] {
+	return &GeneratedTemplate[T]{Template: NewTemplate(tb)}
+}
+
+// Unwrap returns the underlying Template
+func (t *GeneratedTemplate[T]) Unwrap() TemplateInterface {
+	return t.Template
+}
+
+// Build builds the object using the underlying Template and then replaces its name with
+// the name suffixed with the content hash, sets it as immutable and adds the GeneratedFromLabelKey
+// label to it
+func (t *GeneratedTemplate[T]) Build(ctx context.Context, cl client.Client, o client.Object) (client.Object, error) {
+	obj, err := t.Template.Build(ctx, cl, o)
+	if err != nil {
+		return nil, err
+	}
+
+	var content any
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		o.Immutable = util.Pointer(true)
+		content = []any{o.Data, o.BinaryData}
+	case *corev1.Secret:
+		// stringData is write-only, so it needs to be moved to data
+		// for the object to be comparable with the live one
+		for k, v := range o.StringData {
+			if o.Data == nil {
+				o.Data = map[string][]byte{}
+			}
+			o.Data[k] = []byte(v)
+		}
+		o.StringData = nil
+		o.Immutable = util.Pointer(true)
+		content = []any{o.Type, o.Data}
+	default:
+		return nil, fmt.Errorf("unsupported type %T for generated template", obj)
+	}
+
+	hash, err := util.HashWith(util.HashAlgorithmSHA256, content)
+	if err != nil {
+		return nil, err
+	}
+	hash = hash[strings.Index(hash, ":")+1:]
+
+	t.baseName = obj.GetName()
+	t.generatedName = fmt.Sprintf("%s-%s", t.baseName, hash[:generatedNameHashLength])
+	obj.SetName(t.generatedName)
+	obj.SetLabels(util.MergeMaps(map[string]string{}, obj.GetLabels(), map[string]string{GeneratedFromLabelKey(): t.baseName}))
+	return obj, nil
+}
+
+// GetBaseName returns the name of the object before the content hash is appended
+func (t *GeneratedTemplate[T]) GetBaseName() string {
+	return t.baseName
+}
+
+// GetGeneratedName returns the name generated in the last Build() call
+func (t *GeneratedTemplate[T]) GetGeneratedName() string {
+	return t.generatedName
+}
+
+// GetGeneratedKind returns the kind of the generated object
+func (t *GeneratedTemplate[T]) GetGeneratedKind() string {
+	var obj T
+	switch any(obj).(type) {
+	case *corev1.Secret:
+		return "Secret"
+	default:
+		return "ConfigMap"
+	}
+}
@@ -0,0 +1,74 @@
+package resource
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestGeneratedTemplate_Build(t *testing.T) {
+	configMap := func(data map[string]string) TemplateBuilderFunction[*corev1.ConfigMap] {
+		return func(client.Object) (*corev1.ConfigMap, error) {
+			return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "ns"}, Data: data}, nil
+		}
+	}
+	build := func(t *testing.T, template TemplateWithGeneratedName) client.Object {
+		o, err := template.Build(context.TODO(), fake.NewClientBuilder().Build(), nil)
+		if err != nil {
+			t.Fatalf("GeneratedTemplate.Build() error = %v", err)
+		}
+		return o
+	}
+
+	t.Run("Generates the name from the content", func(t *testing.T) {
+		template := NewGeneratedTemplate(configMap(map[string]string{"key": "value"}))
+		cm := build(t, template).(*corev1.ConfigMap)
+		if !strings.HasPrefix(cm.GetName(), "config-") || len(cm.GetName()) != len("config-")+generatedNameHashLength {
+			t.Errorf("GeneratedTemplate.Build() got name %s", cm.GetName())
+		}
+		if cm.Immutable == nil || !*cm.Immutable {
+			t.Errorf("GeneratedTemplate.Build() expected the ConfigMap to be immutable")
+		}
+		if cm.GetLabels()[GeneratedFromLabelKey()] != "config" {
+			t.Errorf("GeneratedTemplate.Build() got labels %v", cm.GetLabels())
+		}
+		if template.GetBaseName() != "config" || template.GetGeneratedName() != cm.GetName() || template.GetGeneratedKind() != "ConfigMap" {
+			t.Errorf("GeneratedTemplate.Build() got %s %s %s", template.GetBaseName(), template.GetGeneratedName(), template.GetGeneratedKind())
+		}
+
+		if other := build(t, NewGeneratedTemplate(configMap(map[string]string{"key": "value"}))); other.GetName() != cm.GetName() {
+			t.Errorf("GeneratedTemplate.Build() expected same name for the same content, got %s and %s", cm.GetName(), other.GetName())
+		}
+		if other := build(t, NewGeneratedTemplate(configMap(map[string]string{"key": "other"}))); other.GetName() == cm.GetName() {
+			t.Errorf("GeneratedTemplate.Build() expected a different name for different content")
+		}
+	})
+
+	t.Run("Moves stringData to data in Secrets", func(t *testing.T) {
+		template := NewGeneratedTemplate(func(client.Object) (*corev1.Secret, error) {
+			return &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "ns"},
+				StringData: map[string]string{"key": "value"}}, nil
+		})
+		s := build(t, template).(*corev1.Secret)
+		if string(s.Data["key"]) != "value" || s.StringData != nil {
+			t.Errorf("GeneratedTemplate.Build() got secret %v", s)
+		}
+		if template.GetGeneratedKind() != "Secret" {
+			t.Errorf("GeneratedTemplate.GetGeneratedKind() = %s", template.GetGeneratedKind())
+		}
+	})
+
+	t.Run("Fails with unsupported types", func(t *testing.T) {
+		template := NewGeneratedTemplate(func(client.Object) (*corev1.Service, error) {
+			return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "svc", Namespace: "ns"}}, nil
+		})
+		if _, err := template.Build(context.TODO(), fake.NewClientBuilder().Build(), nil); err == nil {
+			t.Errorf("GeneratedTemplate.Build() expected error")
+		}
+	})
+}
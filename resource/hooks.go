@@ -0,0 +1,91 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Action is the action that is about to be, or has been, performed on a resource
+type Action string
+
+const (
+	// ActionCreate is the creation of a resource that does not exist
+	ActionCreate Action = "Create"
+	// ActionUpdate is the update of a resource that differs from its template
+	ActionUpdate Action = "Update"
+	// ActionDelete is the deletion of a resource whose template is disabled
+	ActionDelete Action = "Delete"
+	// ActionPrune is the deletion of an owned resource by the resource pruner
+	// because it is not managed by any template anymore
+	ActionPrune Action = "Prune"
+)
+
+// HookFunction is a function that is called before (pre hook) or after (post hook) an action is performed
+// on a resource. It receives the action, the live object and the desired object, both of the template's
+// type. The live object is nil for pre ActionCreate hooks, and the desired object is nil for ActionDelete
+// and ActionPrune hooks.
+// Pre hooks can veto the action by returning an error, or delay it by returning a DelayError. Errors
+// returned by post hooks are returned to the caller, but the action is not retried.
+type HookFunction func(ctx context.Context, cl client.Client, action Action, live, desired client.Object) error
+
+// TemplateWithHooks is an optional interface that templates can implement to run hooks around the
+// actions that CreateOrUpdate and the resource pruner perform on the resource. Resources are pruned
+// precisely because no template manages them anymore, so the hooks of all the templates that manage
+// resources of the same type are called with ActionPrune for every pruned resource of that type, which
+// might not be the resource of the template. Hooks must check the live object they receive when they
+// only apply to some resources. As the prune hooks of a template are only called while the template is
+// in the list of templates being reconciled, hooks that must run whenever a resource of some type is
+// pruned should be registered with the WithPruneHooks method of the reconciler instead.
+type TemplateWithHooks interface {
+	GetPreHooks() []HookFunction
+	GetPostHooks() []HookFunction
+}
+
+// DelayError can be returned by pre hooks to delay the action. The reconciler stops
+// reconciling the owned resources and requeues the owner after the given delay.
+type DelayError struct {
+	// After is the time to wait before retrying the action
+	After time.Duration
+	// Reason explains why the action is delayed
+	Reason string
+}
+
+// Delay returns a DelayError to delay an action for the given time
+func Delay(after time.Duration, reason string) error {
+	return &DelayError{After: after, Reason: reason}
+}
+
+func (e *DelayError) Error() string {
+	return fmt.Sprintf("action delayed %s: %s", e.After, e.Reason)
+}
+
+// AsDelayError returns the DelayError found in the chain of the given error, if any
+func AsDelayError(err error) (*DelayError, bool) {
+	delay := &DelayError{}
+	if errors.As(err, &delay) {
+		return delay, true
+	}
+	return nil, false
+}
+
+// RunHooks calls the given hooks in order, stopping at the first error
+func RunHooks(ctx context.Context, cl client.Client, hooks []HookFunction, action Action, live, desired client.Object) error {
+	for _, hook := range hooks {
+		if err := hook(ctx, cl, action, live, desired); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hooks returns the pre and post hooks of the template
+func hooks(template TemplateInterface) ([]HookFunction, []HookFunction) {
+	if t, ok := TemplateAs[TemplateWithHooks](template); ok {
+		return t.GetPreHooks(), t.GetPostHooks()
+	}
+	return nil, nil
+}
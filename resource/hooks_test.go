@@ -0,0 +1,68 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestCreateOrUpdate_hooks(t *testing.T) {
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns"}}
+	cl := fake.NewClientBuilder().Build()
+	calls := []string{}
+	hook := func(when string) HookFunction {
+		return func(_ context.Context, _ client.Client, action Action, live, desired client.Object) error {
+			calls = append(calls, fmt.Sprintf("%s %s live=%T desired=%v", when, action, live, desired != nil))
+			return nil
+		}
+	}
+	template := func(value string) *Template[*corev1.ConfigMap] {
+		return NewTemplateFromObjectFunction(func() *corev1.ConfigMap {
+			return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}, Data: map[string]string{"key": value}}
+		}).WithEnsureProperties([]Property{"data"}).WithPreHook(hook("pre")).WithPostHook(hook("post"))
+	}
+
+	for _, tmpl := range []*Template[*corev1.ConfigMap]{template("a"), template("a"), template("b"), template("b").WithEnabled(false)} {
+		if _, err := CreateOrUpdate(context.TODO(), cl, scheme.Scheme, owner, tmpl); err != nil {
+			t.Fatalf("CreateOrUpdate() error = %v", err)
+		}
+	}
+	want := []string{
+		"pre Create live=<nil> desired=true", "post Create live=*v1.ConfigMap desired=true",
+		"pre Update live=*v1.ConfigMap desired=true", "post Update live=*v1.ConfigMap desired=true",
+		"pre Delete live=*v1.ConfigMap desired=false", "post Delete live=*v1.ConfigMap desired=false",
+	}
+	if diff := cmp.Diff(calls, want); len(diff) > 0 {
+		t.Errorf("CreateOrUpdate() hook calls diff = %v", diff)
+	}
+
+	t.Run("Pre hooks can veto or delay the action", func(t *testing.T) {
+		for _, tt := range []struct {
+			hookErr   error
+			wantDelay bool
+		}{{fmt.Errorf("veto"), false}, {Delay(time.Minute, "not yet"), true}} {
+			tmpl := template("a").WithPreHook(func(context.Context, client.Client, Action, client.Object, client.Object) error {
+				return tt.hookErr
+			})
+			_, err := CreateOrUpdate(context.TODO(), cl, scheme.Scheme, owner, tmpl)
+			if err == nil {
+				t.Fatalf("CreateOrUpdate() expected error")
+			}
+			if _, ok := AsDelayError(err); ok != tt.wantDelay {
+				t.Errorf("AsDelayError() = %v, want %v", ok, tt.wantDelay)
+			}
+			if err := cl.Get(context.TODO(), types.NamespacedName{Name: "cm", Namespace: "ns"}, &corev1.ConfigMap{}); err == nil {
+				t.Errorf("CreateOrUpdate() expected the resource not to be created")
+			}
+		}
+	})
+}
@@ -0,0 +1,104 @@
+package resource
+
+import (
+	"fmt"
+
+	"github.com/3scale-ops/basereconciler/config"
+	"github.com/3scale-ops/basereconciler/util"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// OwnerUIDLabelKey returns the label used to mark resources that are owned through labels
+// instead of OwnerReferences. The value of the label is the UID of the owner.
+func OwnerUIDLabelKey() string { return fmt.Sprintf("%s/owner-uid", config.GetAnnotationsDomain()) }
+
+// OwnerKindAnnotationKey returns the annotation that holds the kind of the owner (in "Kind.group" format)
+// for resources that are owned through labels.
+func OwnerKindAnnotationKey() string {
+	return fmt.Sprintf("%s/owner-kind", config.GetAnnotationsDomain())
+}
+
+// OwnerNameAnnotationKey returns the annotation that holds the name of the owner for resources
+// that are owned through labels.
+func OwnerNameAnnotationKey() string {
+	return fmt.Sprintf("%s/owner-name", config.GetAnnotationsDomain())
+}
+
+// OwnerNamespaceAnnotationKey returns the annotation that holds the namespace of the owner for resources
+// that are owned through labels.
+func OwnerNamespaceAnnotationKey() string {
+	return fmt.Sprintf("%s/owner-namespace", config.GetAnnotationsDomain())
+}
+
+// RequiresLabelOwnership returns true if the object cannot be owned by the owner using an OwnerReference.
+// OwnerReferences are not allowed when a namespaced owner tries to own a cluster scoped resource or a
+// resource in a different namespace, so label based ownership is used in those cases. Cluster scoped
+// objects are expected to have an empty namespace.
+func RequiresLabelOwnership(owner client.Object, namespace string) bool {
+	return owner.GetNamespace() != "" && owner.GetNamespace() != namespace
+}
+
+// SetOwner marks the object as owned by the owner. An OwnerReference is used when possible, falling
+// back to label based ownership for cluster scoped or cross namespace resources (see RequiresLabelOwnership).
+// Resources owned through labels are not garbage collected by Kubernetes, so they need to be cleaned up
+// by the controller when the owner is deleted.
+func SetOwner(owner, o client.Object, scheme *runtime.Scheme) error {
+	if RequiresLabelOwnership(owner, o.GetNamespace()) {
+		return setLabelOwner(owner, o, scheme)
+	}
+	return controllerutil.SetControllerReference(owner, o, scheme)
+}
+
+func setLabelOwner(owner, o client.Object, scheme *runtime.Scheme) error {
+	gvk, err := apiutil.GVKForObject(owner, scheme)
+	if err != nil {
+		return fmt.Errorf("unable to get GVK for owner: %w", err)
+	}
+	o.SetLabels(util.MergeMaps(map[string]string{}, o.GetLabels(), map[string]string{
+		OwnerUIDLabelKey(): string(owner.GetUID()),
+	}))
+	o.SetAnnotations(util.MergeMaps(map[string]string{}, o.GetAnnotations(), map[string]string{
+		OwnerKindAnnotationKey():      gvk.GroupKind().String(),
+		OwnerNameAnnotationKey():      owner.GetName(),
+		OwnerNamespaceAnnotationKey(): owner.GetNamespace(),
+	}))
+	return nil
+}
+
+// IsOwnedBy returns true if the object is owned by the owner, either through an OwnerReference or
+// through labels. The version of the OwnerReference is ignored, like controllerutil does, so objects
+// are still recognized as owned after the version of the owner's API changes.
+func IsOwnedBy(o, owner client.Object, ownerGVK schema.GroupVersionKind) bool {
+	if util.ContainsBy(o.GetOwnerReferences(), func(ref metav1.OwnerReference) bool {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		return err == nil && gv.Group == ownerGVK.Group && ref.Kind == ownerGVK.Kind && ref.Name == owner.GetName()
+	}) {
+		return true
+	}
+
+	gk, key, ok := GetLabelOwner(o)
+	return ok && gk == ownerGVK.GroupKind() && key == client.ObjectKeyFromObject(owner) &&
+		o.GetLabels()[OwnerUIDLabelKey()] == string(owner.GetUID())
+}
+
+// GetLabelOwner returns the GroupKind and the key of the owner of a resource that is
+// owned through labels. The last return value is false if the resource is not owned through labels.
+func GetLabelOwner(o client.Object) (schema.GroupKind, types.NamespacedName, bool) {
+	if _, ok := o.GetLabels()[OwnerUIDLabelKey()]; !ok {
+		return schema.GroupKind{}, types.NamespacedName{}, false
+	}
+	annotations := o.GetAnnotations()
+	kind, ok := annotations[OwnerKindAnnotationKey()]
+	if !ok {
+		return schema.GroupKind{}, types.NamespacedName{}, false
+	}
+	return schema.ParseGroupKind(kind),
+		types.NamespacedName{Name: annotations[OwnerNameAnnotationKey()], Namespace: annotations[OwnerNamespaceAnnotationKey()]},
+		true
+}
@@ -0,0 +1,155 @@
+package resource
+
+import (
+	"testing"
+
+	"github.com/3scale-ops/basereconciler/util"
+	"github.com/google/go-cmp/cmp"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestSetOwner(t *testing.T) {
+	type args struct {
+		owner client.Object
+		o     client.Object
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    client.Object
+		wantErr bool
+	}{
+		{
+			name: "Sets an OwnerReference",
+			args: args{
+				owner: &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"}},
+				o:     &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			},
+			want: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion:         "v1",
+					Kind:               "ServiceAccount",
+					Name:               "owner",
+					UID:                "uid",
+					Controller:         util.Pointer(true),
+					BlockOwnerDeletion: util.Pointer(true),
+				}},
+			}},
+			wantErr: false,
+		},
+		{
+			name: "Sets owner labels on cluster scoped resources",
+			args: args{
+				owner: &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"}},
+				o:     &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cr"}},
+			},
+			want: &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cr",
+				Labels: map[string]string{OwnerUIDLabelKey(): "uid"},
+				Annotations: map[string]string{
+					OwnerKindAnnotationKey():      "ServiceAccount",
+					OwnerNameAnnotationKey():      "owner",
+					OwnerNamespaceAnnotationKey(): "ns",
+				},
+			}},
+			wantErr: false,
+		},
+		{
+			name: "Sets owner labels on resources in other namespaces",
+			args: args{
+				owner: &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"}},
+				o: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "other",
+					Labels: map[string]string{"key": "value"}}},
+			},
+			want: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "secret", Namespace: "other",
+				Labels: map[string]string{"key": "value", OwnerUIDLabelKey(): "uid"},
+				Annotations: map[string]string{
+					OwnerKindAnnotationKey():      "ServiceAccount",
+					OwnerNameAnnotationKey():      "owner",
+					OwnerNamespaceAnnotationKey(): "ns",
+				},
+			}},
+			wantErr: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := SetOwner(tt.args.owner, tt.args.o, scheme.Scheme); (err != nil) != tt.wantErr {
+				t.Errorf("SetOwner() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if diff := cmp.Diff(tt.args.o, tt.want); len(diff) > 0 {
+				t.Errorf("SetOwner() diff = %v", diff)
+			}
+		})
+	}
+}
+
+func TestIsOwnedBy(t *testing.T) {
+	owner := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "owner", Namespace: "ns", UID: "uid"}}
+	ownerGVK := schema.FromAPIVersionAndKind("v1", "ServiceAccount")
+
+	tests := []struct {
+		name string
+		o    client.Object
+		want bool
+	}{
+		{
+			name: "Owned through OwnerReference",
+			o: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "v1", Kind: "ServiceAccount", Name: "owner"}}}},
+			want: true,
+		},
+		{
+			name: "Owned through OwnerReference of other version",
+			o: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "v2", Kind: "ServiceAccount", Name: "owner"}}}},
+			want: true,
+		},
+		{
+			name: "Not owned through OwnerReference of other group",
+			o: &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns",
+				OwnerReferences: []metav1.OwnerReference{{APIVersion: "example.com/v1", Kind: "ServiceAccount", Name: "owner"}}}},
+			want: false,
+		},
+		{
+			name: "Owned through labels",
+			o: &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cr",
+				Labels: map[string]string{OwnerUIDLabelKey(): "uid"},
+				Annotations: map[string]string{
+					OwnerKindAnnotationKey():      "ServiceAccount",
+					OwnerNameAnnotationKey():      "owner",
+					OwnerNamespaceAnnotationKey(): "ns",
+				},
+			}},
+			want: true,
+		},
+		{
+			name: "Owned through labels by other owner",
+			o: &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "cr",
+				Labels: map[string]string{OwnerUIDLabelKey(): "other-uid"},
+				Annotations: map[string]string{
+					OwnerKindAnnotationKey():      "ServiceAccount",
+					OwnerNameAnnotationKey():      "owner",
+					OwnerNamespaceAnnotationKey(): "other",
+				},
+			}},
+			want: false,
+		},
+		{
+			name: "Not owned",
+			o:    &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm", Namespace: "ns"}},
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsOwnedBy(tt.o, owner, ownerGVK); got != tt.want {
+				t.Errorf("IsOwnedBy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -15,6 +15,92 @@ type TemplateInterface interface {
 	GetIgnoreProperties() []Property
 }
 
+// ReconcilePolicy defines how the resource described by a template is reconciled
+type ReconcilePolicy string
+
+const (
+	// ReconcilePolicyCreateOrUpdate creates the resource if it does not exist and
+	// updates it whenever it differs from the template. This is the default policy.
+	ReconcilePolicyCreateOrUpdate ReconcilePolicy = "CreateOrUpdate"
+	// ReconcilePolicyCreateOnly creates the resource if it does not exist but never updates
+	// it afterwards, so the resource can be freely modified once created. This is useful for
+	// generated passwords, initial credentials or bootstrap configurations that users edit.
+	// The resource is still deleted if the template is disabled.
+	ReconcilePolicyCreateOnly ReconcilePolicy = "CreateOnly"
+)
+
+// TemplateWithReconcilePolicy is an optional interface that templates can implement to
+// configure the reconcile policy of the resource. Templates that don't implement it use
+// ReconcilePolicyCreateOrUpdate.
+type TemplateWithReconcilePolicy interface {
+	GetReconcilePolicy() ReconcilePolicy
+}
+
+// Presence defines whether the resource described by a template should exist or not,
+// or if it is not managed at all
+type Presence string
+
+const (
+	// PresencePresent creates the resource if it does not exist and reconciles it
+	PresencePresent Presence = "Present"
+	// PresenceAbsent deletes the resource if it exists
+	PresenceAbsent Presence = "Absent"
+	// PresenceUnmanaged neither creates, updates nor deletes the resource. If the resource
+	// exists it still counts as managed, so the resource pruner does not delete it. This is
+	// useful to hand over the ownership of a resource to another controller or to the user.
+	PresenceUnmanaged Presence = "Unmanaged"
+)
+
+// TemplateWithPresence is an optional interface that templates can implement to configure
+// the presence of the resource. Templates that don't implement it, or that return an empty
+// Presence, use PresencePresent or PresenceAbsent depending on the value returned by Enabled().
+type TemplateWithPresence interface {
+	GetPresence() Presence
+}
+
+// wrappedTemplate is implemented by templates that wrap other templates, so
+// the optional interfaces implemented by the wrapped template can be found
+type wrappedTemplate interface {
+	Unwrap() TemplateInterface
+}
+
+// TemplateAs looks for the first template in the chain of wrapped templates that implements
+// the interface T. Templates that wrap other templates must implement an "Unwrap() TemplateInterface"
+// method for the optional interfaces of the wrapped templates to be found.
+func TemplateAs[T any](template TemplateInterface) (T, bool) {
+	for template != nil {
+		if t, ok := template.(T); ok {
+			return t, true
+		}
+		w, ok := template.(wrappedTemplate)
+		if !ok {
+			break
+		}
+		template = w.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// reconcilePolicy returns the reconcile policy of the template
+func reconcilePolicy(template TemplateInterface) ReconcilePolicy {
+	if t, ok := TemplateAs[TemplateWithReconcilePolicy](template); ok && t.GetReconcilePolicy() != "" {
+		return t.GetReconcilePolicy()
+	}
+	return ReconcilePolicyCreateOrUpdate
+}
+
+// presence returns the presence of the resource described by the template
+func presence(template TemplateInterface) Presence {
+	if t, ok := TemplateAs[TemplateWithPresence](template); ok && t.GetPresence() != "" {
+		return t.GetPresence()
+	}
+	if template.Enabled() {
+		return PresencePresent
+	}
+	return PresenceAbsent
+}
+
 // TemplateBuilderFunction is a function that returns a k8s API object (client.Object) when
 // called. TemplateBuilderFunction has no access to cluster live info.
 // A TemplateBuilderFunction is used to return the basic shape of a resource (a template) that can
@@ -27,6 +113,27 @@ type TemplateBuilderFunction[T client.Object] func(client.Object) (T, error)
 // a kubernetes API server.
 type TemplateMutationFunction func(context.Context, client.Client, client.Object) error
 
+// apiReaderKey is the context key of the reader set by ContextWithAPIReader
+type apiReaderKey struct{}
+
+// ContextWithAPIReader returns a copy of the context that carries a reader that reads directly
+// from the API server, bypassing the cache. The reconciler sets it in the context passed to the
+// TemplateMutationFunctions, so they can read objects that must not be stale (see APIReaderFrom).
+func ContextWithAPIReader(ctx context.Context, reader client.Reader) context.Context {
+	return context.WithValue(ctx, apiReaderKey{}, reader)
+}
+
+// APIReaderFrom returns the reader set in the context by ContextWithAPIReader, or the
+// passed client if there is none. It is used by the TemplateMutationFunctions that need
+// to read the live state of the object they mutate, as the cache might not have caught up
+// with recent changes to it (for example right after it has been created).
+func APIReaderFrom(ctx context.Context, cl client.Client) client.Reader {
+	if reader, ok := ctx.Value(apiReaderKey{}).(client.Reader); ok && reader != nil {
+		return reader
+	}
+	return cl
+}
+
 // Template implements TemplateInterface.
 type Template[T client.Object] struct {
 	// TemplateBuilder is the function that is used as the basic
@@ -38,8 +145,12 @@ type Template[T client.Object] struct {
 	// access to a kubernetes API server.
 	TemplateMutations []TemplateMutationFunction
 	// IsEnabled specifies whether the resource described by this Template should
-	// exist or not.
+	// exist or not. It is ignored if Presence is set.
 	IsEnabled bool
+	// Presence specifies whether the resource described by this Template should exist,
+	// should not exist or is not managed (see PresenceUnmanaged). Takes precedence over
+	// IsEnabled when set.
+	Presence Presence
 	// EnsureProperties are the properties from the desired object that should be enforced
 	// to the live object. The syntax is jsonpath.
 	EnsureProperties []Property
@@ -47,6 +158,18 @@ type Template[T client.Object] struct {
 	// updates. This is used to ignore nested properties within the "EnsuredProperties". The
 	// syntax is jsonpath.
 	IgnoreProperties []Property
+	// ReconcilePolicy specifies how the resource is reconciled. Defaults
+	// to ReconcilePolicyCreateOrUpdate.
+	ReconcilePolicy ReconcilePolicy
+	// AdoptionPolicy specifies what happens when the resource already exists but is
+	// not owned by the owner. Defaults to AdoptionPolicyIgnore.
+	AdoptionPolicy AdoptionPolicy
+	// PreHooks are functions that are called before the resource is created, updated
+	// or deleted (see HookFunction).
+	PreHooks []HookFunction
+	// PostHooks are functions that are called after the resource has been created,
+	// updated or deleted (see HookFunction).
+	PostHooks []HookFunction
 }
 
 // NewTemplate returns a new Template struct using the passed parameters
@@ -85,9 +208,17 @@ func (t *Template[T]) Build(ctx context.Context, cl client.Client, o client.Obje
 
 // Enabled indicates if the resource should be present or not
 func (t *Template[T]) Enabled() bool {
+	if t.Presence != "" {
+		return t.Presence == PresencePresent
+	}
 	return t.IsEnabled
 }
 
+// GetPresence returns the presence of the resource
+func (t *Template[T]) GetPresence() Presence {
+	return t.Presence
+}
+
 // GetEnsureProperties returns the list of properties that should be reconciled
 func (t *Template[T]) GetEnsureProperties() []Property {
 	return t.EnsureProperties
@@ -119,6 +250,11 @@ func (t *Template[T]) WithEnabled(enabled bool) *Template[T] {
 	return t
 }
 
+func (t *Template[T]) WithPresence(presence Presence) *Template[T] {
+	t.Presence = presence
+	return t
+}
+
 func (t *Template[T]) WithEnsureProperties(ensure []Property) *Template[T] {
 	t.EnsureProperties = ensure
 	return t
@@ -129,6 +265,46 @@ func (t *Template[T]) WithIgnoreProperties(ignore []Property) *Template[T] {
 	return t
 }
 
+func (t *Template[T]) WithReconcilePolicy(policy ReconcilePolicy) *Template[T] {
+	t.ReconcilePolicy = policy
+	return t
+}
+
+// GetReconcilePolicy returns the reconcile policy of the resource
+func (t *Template[T]) GetReconcilePolicy() ReconcilePolicy {
+	return t.ReconcilePolicy
+}
+
+func (t *Template[T]) WithAdoptionPolicy(policy AdoptionPolicy) *Template[T] {
+	t.AdoptionPolicy = policy
+	return t
+}
+
+// GetAdoptionPolicy returns the adoption policy of the resource
+func (t *Template[T]) GetAdoptionPolicy() AdoptionPolicy {
+	return t.AdoptionPolicy
+}
+
+func (t *Template[T]) WithPreHook(fn HookFunction) *Template[T] {
+	t.PreHooks = append(t.PreHooks, fn)
+	return t
+}
+
+func (t *Template[T]) WithPostHook(fn HookFunction) *Template[T] {
+	t.PostHooks = append(t.PostHooks, fn)
+	return t
+}
+
+// GetPreHooks returns the hooks called before an action is performed on the resource
+func (t *Template[T]) GetPreHooks() []HookFunction {
+	return t.PreHooks
+}
+
+// GetPostHooks returns the hooks called after an action is performed on the resource
+func (t *Template[T]) GetPostHooks() []HookFunction {
+	return t.PostHooks
+}
+
 // Apply chains template functions to make them composable
 func (t *Template[T]) Apply(mutation TemplateBuilderFunction[T]) *Template[T] {
 
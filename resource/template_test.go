@@ -35,3 +35,74 @@ func TestTemplate_Apply(t *testing.T) {
 		t.Errorf("(Template).Apply() diff = %v", diff)
 	}
 }
+
+type testWrapperTemplate struct {
+	TemplateInterface
+}
+
+func (t testWrapperTemplate) Unwrap() TemplateInterface { return t.TemplateInterface }
+
+func Test_reconcilePolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		template TemplateInterface
+		want     ReconcilePolicy
+	}{
+		{
+			name:     "Defaults to CreateOrUpdate",
+			template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap { return &corev1.ConfigMap{} }),
+			want:     ReconcilePolicyCreateOrUpdate,
+		},
+		{
+			name: "Returns the template policy",
+			template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap { return &corev1.ConfigMap{} }).
+				WithReconcilePolicy(ReconcilePolicyCreateOnly),
+			want: ReconcilePolicyCreateOnly,
+		},
+		{
+			name: "Returns the policy of wrapped templates",
+			template: testWrapperTemplate{NewTemplateFromObjectFunction(func() *corev1.ConfigMap { return &corev1.ConfigMap{} }).
+				WithReconcilePolicy(ReconcilePolicyCreateOnly)},
+			want: ReconcilePolicyCreateOnly,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := reconcilePolicy(tt.template); got != tt.want {
+				t.Errorf("reconcilePolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_presence(t *testing.T) {
+	tests := []struct {
+		name     string
+		template TemplateInterface
+		want     Presence
+	}{
+		{
+			name:     "Enabled templates are present",
+			template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap { return &corev1.ConfigMap{} }),
+			want:     PresencePresent,
+		},
+		{
+			name:     "Disabled templates are absent",
+			template: NewTemplateFromObjectFunction(func() *corev1.ConfigMap { return &corev1.ConfigMap{} }).WithEnabled(false),
+			want:     PresenceAbsent,
+		},
+		{
+			name: "Returns the presence of wrapped templates",
+			template: testWrapperTemplate{NewTemplateFromObjectFunction(func() *corev1.ConfigMap { return &corev1.ConfigMap{} }).
+				WithPresence(PresenceUnmanaged)},
+			want: PresenceUnmanaged,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := presence(tt.template); got != tt.want {
+				t.Errorf("presence() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
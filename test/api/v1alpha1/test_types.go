@@ -23,6 +23,7 @@ import (
 	"github.com/3scale-ops/basereconciler/reconciler"
 	"github.com/3scale-ops/basereconciler/util"
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
@@ -98,6 +99,13 @@ func (t *Test) GetStatus() reconciler.AppStatus {
 	return &t.Status
 }
 
+var _ reconciler.ObjectWithReferences = &Test{}
+
+// GetReferences returns the objects referenced by the Test resource
+func (t *Test) GetReferences() []corev1.ObjectReference {
+	return []corev1.ObjectReference{{APIVersion: "v1", Kind: "Secret", Name: "secret"}}
+}
+
 // +kubebuilder:object:root=true
 
 // TestList contains a list of Test
@@ -161,6 +161,9 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := reconciler.IndexReferences(context.Background(), mgr.GetFieldIndexer(), &v1alpha1.Test{}); err != nil {
+		return err
+	}
 	return reconciler.SetupWithDynamicTypeWatches(r,
 		ctrl.NewControllerManagedBy(mgr).
 			For(&v1alpha1.Test{}).
@@ -170,7 +173,9 @@ func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
 					func(event, o client.Object) bool {
 						return event.GetName() == "secret"
 					},
-					r.Log)),
+					r.Log)).
+			Watches(&corev1.Secret{TypeMeta: metav1.TypeMeta{Kind: "Secret"}},
+				r.IndexedEventHandler(&v1alpha1.TestList{}, r.Log)),
 	)
 }
 
@@ -185,7 +185,9 @@ var _ = Describe("Test controller", func() {
 				value, ok := dep.Spec.Template.ObjectMeta.Annotations["example.com/secret.secret-hash"]
 				Expect(ok).To(BeTrue())
 				// Value of the annotation should be the hash of the Secret contents
-				return value == util.Hash(secret.Data)
+				hash, err := util.HashWith(util.HashAlgorithmSHA256, secret.Data)
+				Expect(err).ToNot(HaveOccurred())
+				return value == hash
 			}, timeout, poll).Should(BeTrue())
 
 			patch := client.MergeFrom(secret.DeepCopy())
@@ -203,7 +205,9 @@ var _ = Describe("Test controller", func() {
 				value, ok := dep.Spec.Template.ObjectMeta.Annotations["example.com/secret.secret-hash"]
 				Expect(ok).To(BeTrue())
 				// Value of the annotation should be the hash of the Secret new contents
-				return value == util.Hash(secret.Data)
+				hash, err := util.HashWith(util.HashAlgorithmSHA256, secret.Data)
+				Expect(err).ToNot(HaveOccurred())
+				return value == hash
 			}, timeout, poll).Should(BeTrue())
 		})
 
@@ -1,14 +1,38 @@
 package util
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"hash"
 	"hash/fnv"
 
 	"github.com/davecgh/go-spew/spew"
 	"k8s.io/apimachinery/pkg/util/rand"
 )
 
+// HashAlgorithm is the algorithm used by HashWith
+type HashAlgorithm string
+
+const (
+	// HashAlgorithmSHA256 hashes the canonical serialization of the object with sha256
+	HashAlgorithmSHA256 HashAlgorithm = "sha256"
+	// HashAlgorithmFNV64a hashes the canonical serialization of the object with 64-bit FNV-1a
+	HashAlgorithmFNV64a HashAlgorithm = "fnv64a"
+	// HashAlgorithmLegacy is the algorithm used by Hash: a 32-bit FNV-1a of a go-spew dump
+	// of the object. Its hashes are not tagged with the algorithm.
+	HashAlgorithmLegacy HashAlgorithm = "legacy"
+)
+
+// hashFormatVersion is the version of the canonical serialization used by
+// HashWith. It needs to be bumped if the serialization ever changes.
+const hashFormatVersion = "v1"
+
 // Hash returns a hash of the passed object
+//
+// Deprecated: the result depends on the go-spew formatting and has a high collision
+// risk. Use HashWith instead.
 func Hash(o interface{}) string {
 	hasher := fnv.New32a()
 	hasher.Reset()
@@ -21,3 +45,29 @@ func Hash(o interface{}) string {
 	printer.Fprintf(hasher, "%#v", o)
 	return rand.SafeEncodeString(fmt.Sprint(hasher.Sum32()))
 }
+
+// HashWith returns a hash of the passed object using the given algorithm. The object is
+// serialized to JSON (map keys are sorted, so the serialization is canonical) before hashing.
+// The returned hash is tagged with the algorithm and the serialization version, with
+// "<algorithm>.<version>:<hex digest>" format, so hashes produced with different algorithms
+// or versions never match.
+func HashWith(algorithm HashAlgorithm, o interface{}) (string, error) {
+	var hasher hash.Hash
+	switch algorithm {
+	case HashAlgorithmSHA256:
+		hasher = sha256.New()
+	case HashAlgorithmFNV64a:
+		hasher = fnv.New64a()
+	case HashAlgorithmLegacy:
+		return Hash(o), nil
+	default:
+		return "", fmt.Errorf("unknown hash algorithm '%s'", algorithm)
+	}
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		return "", fmt.Errorf("unable to serialize object for hashing: %w", err)
+	}
+	hasher.Write(data)
+	return fmt.Sprintf("%s.%s:%s", algorithm, hashFormatVersion, hex.EncodeToString(hasher.Sum(nil))), nil
+}
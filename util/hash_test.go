@@ -0,0 +1,66 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashWith(t *testing.T) {
+	tests := []struct {
+		name       string
+		algorithm  HashAlgorithm
+		o          interface{}
+		wantPrefix string
+		wantErr    bool
+	}{
+		{
+			name:       "sha256",
+			algorithm:  HashAlgorithmSHA256,
+			o:          map[string]string{"a": "1", "b": "2"},
+			wantPrefix: "sha256.v1:",
+		},
+		{
+			name:       "fnv64a",
+			algorithm:  HashAlgorithmFNV64a,
+			o:          map[string]string{"a": "1", "b": "2"},
+			wantPrefix: "fnv64a.v1:",
+		},
+		{
+			name:      "Unknown algorithm",
+			algorithm: HashAlgorithm("md5"),
+			o:         map[string]string{"a": "1"},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HashWith(tt.algorithm, tt.o)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("HashWith() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("HashWith() = %v, want prefix %v", got, tt.wantPrefix)
+			}
+		})
+	}
+}
+
+func TestHashWith_canonical(t *testing.T) {
+	a := map[string][]byte{}
+	b := map[string][]byte{}
+	for _, k := range []string{"x", "y", "z"} {
+		a[k] = []byte(k)
+	}
+	for _, k := range []string{"z", "y", "x"} {
+		b[k] = []byte(k)
+	}
+	hashA, _ := HashWith(HashAlgorithmSHA256, a)
+	hashB, _ := HashWith(HashAlgorithmSHA256, b)
+	if hashA != hashB {
+		t.Errorf("HashWith() = %v and %v, want equal hashes", hashA, hashB)
+	}
+	if legacy, _ := HashWith(HashAlgorithmLegacy, a); legacy != Hash(a) {
+		t.Errorf("HashWith() = %v, want %v", legacy, Hash(a))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
@@ -94,3 +95,81 @@ func ResourceDefaulter(o Defaulter) func(context.Context, client.Client, client.
 		return nil
 	}
 }
+
+// PodSpecReferences returns the names of the Secrets and ConfigMaps referenced by the
+// PodSpec, either in volumes (including projected volumes) or in the environment of
+// the containers and init containers (envFrom and env valueFrom). The returned
+// lists are sorted and do not contain duplicates.
+func PodSpecReferences(spec *corev1.PodSpec) (secrets []string, configMaps []string) {
+	secretSet := map[string]struct{}{}
+	configMapSet := map[string]struct{}{}
+
+	for _, vol := range spec.Volumes {
+		if vol.Secret != nil {
+			secretSet[vol.Secret.SecretName] = struct{}{}
+		}
+		if vol.ConfigMap != nil {
+			configMapSet[vol.ConfigMap.Name] = struct{}{}
+		}
+		if vol.Projected != nil {
+			for _, src := range vol.Projected.Sources {
+				if src.Secret != nil {
+					secretSet[src.Secret.Name] = struct{}{}
+				}
+				if src.ConfigMap != nil {
+					configMapSet[src.ConfigMap.Name] = struct{}{}
+				}
+			}
+		}
+	}
+
+	for _, c := range append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...) {
+		for _, env := range c.EnvFrom {
+			if env.SecretRef != nil {
+				secretSet[env.SecretRef.Name] = struct{}{}
+			}
+			if env.ConfigMapRef != nil {
+				configMapSet[env.ConfigMapRef.Name] = struct{}{}
+			}
+		}
+		for _, env := range c.Env {
+			if env.ValueFrom == nil {
+				continue
+			}
+			if env.ValueFrom.SecretKeyRef != nil {
+				secretSet[env.ValueFrom.SecretKeyRef.Name] = struct{}{}
+			}
+			if env.ValueFrom.ConfigMapKeyRef != nil {
+				configMapSet[env.ValueFrom.ConfigMapKeyRef.Name] = struct{}{}
+			}
+		}
+	}
+
+	return sortedKeys(secretSet), sortedKeys(configMapSet)
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ImageRepository returns the repository of a container image reference, which
+// is the image reference without the tag and the digest. For example, the repository
+// of "quay.io/3scale/apicast:v1@sha256:abcd" is "quay.io/3scale/apicast".
+func ImageRepository(image string) string {
+	if idx := strings.Index(image, "@"); idx >= 0 {
+		image = image[:idx]
+	}
+	// a colon after the last slash separates the tag, otherwise
+	// it separates the port of the registry host
+	if idx := strings.LastIndex(image, ":"); idx > strings.LastIndex(image, "/") {
+		image = image[:idx]
+	}
+	return image
+}
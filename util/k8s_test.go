@@ -196,3 +196,88 @@ func TestResourceDefaulter(t *testing.T) {
 		})
 	}
 }
+
+func TestPodSpecReferences(t *testing.T) {
+	tests := []struct {
+		name           string
+		spec           *corev1.PodSpec
+		wantSecrets    []string
+		wantConfigMaps []string
+	}{
+		{
+			name: "Returns the references",
+			spec: &corev1.PodSpec{
+				Volumes: []corev1.Volume{
+					{Name: "a", VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: "secret-vol"}}},
+					{Name: "b", VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "cm-vol"}}}},
+					{Name: "c", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+						Sources: []corev1.VolumeProjection{
+							{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "secret-projected"}}},
+							{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: "cm-projected"}}},
+						}}}},
+				},
+				InitContainers: []corev1.Container{{
+					Name: "init",
+					EnvFrom: []corev1.EnvFromSource{
+						{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "secret-envfrom"}}},
+					},
+				}},
+				Containers: []corev1.Container{{
+					Name: "container",
+					EnvFrom: []corev1.EnvFromSource{
+						{ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "cm-envfrom"}}},
+					},
+					Env: []corev1.EnvVar{
+						{Name: "A", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "secret-vol"}, Key: "a"}}},
+						{Name: "B", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "cm-env"}, Key: "b"}}},
+						{Name: "C", Value: "value"},
+					},
+				}},
+			},
+			wantSecrets:    []string{"secret-envfrom", "secret-projected", "secret-vol"},
+			wantConfigMaps: []string{"cm-env", "cm-envfrom", "cm-projected", "cm-vol"},
+		},
+		{
+			name:           "Returns empty lists",
+			spec:           &corev1.PodSpec{Containers: []corev1.Container{{Name: "container"}}},
+			wantSecrets:    []string{},
+			wantConfigMaps: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSecrets, gotConfigMaps := PodSpecReferences(tt.spec)
+			if !reflect.DeepEqual(gotSecrets, tt.wantSecrets) {
+				t.Errorf("PodSpecReferences() gotSecrets = %v, want %v", gotSecrets, tt.wantSecrets)
+			}
+			if !reflect.DeepEqual(gotConfigMaps, tt.wantConfigMaps) {
+				t.Errorf("PodSpecReferences() gotConfigMaps = %v, want %v", gotConfigMaps, tt.wantConfigMaps)
+			}
+		})
+	}
+}
+
+func TestImageRepository(t *testing.T) {
+	tests := []struct {
+		name  string
+		image string
+		want  string
+	}{
+		{name: "Image with tag", image: "quay.io/3scale/apicast:v1", want: "quay.io/3scale/apicast"},
+		{name: "Image with digest", image: "quay.io/3scale/apicast@sha256:abcd", want: "quay.io/3scale/apicast"},
+		{name: "Image with tag and digest", image: "quay.io/3scale/apicast:v1@sha256:abcd", want: "quay.io/3scale/apicast"},
+		{name: "Registry with port", image: "localhost:5000/apicast:v1", want: "localhost:5000/apicast"},
+		{name: "Registry with port and no tag", image: "localhost:5000/apicast", want: "localhost:5000/apicast"},
+		{name: "Image without tag", image: "apicast", want: "apicast"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ImageRepository(tt.image); got != tt.want {
+				t.Errorf("ImageRepository() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}